@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GetMeReturn - bot information
+type GetMeReturn struct {
+	Result struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"result"`
+	Ok bool `json:"ok"`
+}
+
+var botName struct {
+	Name string
+	Once sync.Once
+}
+
+// parseAccessMode(string) string
+// access mode from env value. Unknown value is 'open'
+func parseAccessMode(mode string) string {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case accessAllowlist, accessInvite, accessApproval:
+		return mode
+	case "", accessOpen:
+	default:
+		toLog("unknown access mode", mode)
+	}
+	return accessOpen
+}
+
+// checkAccessMode(string, map[int64]bool) error
+// invite and approval modes need admins, without them nobody can get access
+func checkAccessMode(mode string, admins map[int64]bool) error {
+	if (mode == accessInvite || mode == accessApproval) && len(admins) == 0 {
+		return errors.New("ACCESS=" + mode + " needs ADMINS")
+	}
+	return nil
+}
+
+// parseAllowlist(string) map[string]bool
+// chat IDs and usernames(without '@', lower case) from env value like "123,@name"
+func parseAllowlist(list string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, v := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		ret[strings.ToLower(strings.TrimPrefix(v, "@"))] = true
+	}
+	return ret
+}
+
+// getBotName() string
+// bot username for deep links
+func getBotName() string {
+	botName.Once.Do(func() {
+		r := new(GetMeReturn)
+		telegramQuery("/getMe", struct{}{}, r, false, "")
+		botName.Name = r.Result.Username
+	})
+	return botName.Name
+}
+
+// newInviteCode() string
+// random one-time code for deep link
+func newInviteCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		toLog(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// userName() string
+// username from update or from database
+func (o *botUser) userName() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.Db.FindCreate("users").Print(o.Sid)
+}
+
+// accessAllowed() bool
+// check user by current access mode
+func (o *botUser) accessAllowed() bool {
+	if o.isAdmin() {
+		return true
+	}
+	switch accessMode {
+	case accessAllowlist:
+		return allowlist[o.Sid] || (o.userName() != "" && allowlist[strings.ToLower(o.userName())])
+	case accessInvite, accessApproval:
+		return sBool(o.getParameter(paramParam, paramAccess))
+	}
+	return true
+}
+
+// redeemInvite(string) bool
+// give access by one-time invite code
+func (o *botUser) redeemInvite(code string) bool {
+	// one transaction: code can't be used twice by parallel requests
+	if code == "" || o.Db.FindCreate("invites").Take(code) == "" {
+		return false
+	}
+	o.setParameter(paramParam, paramAccess, true)
+	toLog("invite used", code, o.Sid)
+	return true
+}
+
+// startAccess(Message, *botUser, *Tasker) bool
+// gate for 'start' command. Redeem invite code or ask admins for approval
+func (obj *Action) startAccess(message Message, usr *botUser, MainTasker *Tasker) bool {
+	if usr.accessAllowed() {
+		return true
+	}
+	message.ReplyMarkup = Buttons{}
+	switch accessMode {
+	case accessInvite:
+		if usr.redeemInvite(commandArgument(message, commandStart)) {
+			return true
+		}
+		message.Text = message.tr("Access by invitation only. Ask the bot owner for an invite link.")
+	case accessApproval:
+		if sBool(usr.getParameter(paramParam, paramAccessDenied)) {
+			// admins are not asked again
+			message.Text = message.tr("Access denied.")
+			break
+		}
+		if sBool(usr.getParameter(paramParam, paramAccessPending)) {
+			message.Text = message.tr("Your request is waiting for approval.")
+			break
+		}
+		usr.setParameter(paramParam, paramAccessPending, true)
+		for id := range admins {
+			request := Message{}
+			request.ChatID = id
+			request.ParseMode = htmlMode
+			request.LanguageCode = message.LanguageCode
+			request.Text = request.tr("Access request") + sprintf(": <code>%d</code> @%s", usr.Id, usr.userName())
+			versions := make(map[string]string)
+			versions[request.tr("✅ approve")] = "/" + commandAccessApprove + usr.Sid
+			versions[request.tr("❌ deny")] = "/" + commandAccessDeny + usr.Sid
+			request.ReplyMarkup = Button{InlineKeyboard: buttomsMap(versions)}
+			MainTasker.Add(nil, request.SendMessageWrapperTask, &request)
+		}
+		message.Text = message.tr("Request sent. You will get a message after approval.")
+	default:
+		message.Text = message.tr("Access denied.")
+	}
+	MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	return false
+}
+
+// addAccessCommands(*Commands, *Tasker)
+// admin commands for invite codes and approval buttons
+func (obj *Action) addAccessCommands(cmds *Commands, MainTasker *Tasker) {
+	answer := func(message Message, approved bool) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		name := commandAccessDeny
+		if approved {
+			name = commandAccessApprove
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(message.Command, "/"+name), 10, 64)
+		if err != nil {
+			return
+		}
+		target := new(botUser).New(obj.Db, id)
+		target.setParameter(paramParam, paramAccessPending, false)
+		target.setParameter(paramParam, paramAccess, approved)
+		target.setParameter(paramParam, paramAccessDenied, !approved)
+		notice := Message{}
+		notice.ChatID = id
+		notice.ParseMode = htmlMode
+		notice.LanguageCode = message.LanguageCode
+		if approved {
+			notice.Text = notice.tr("Access approved. Press 'start'.")
+			notice.ReplyMarkup = new(Buttons).NewLine().Add("/" + commandStart).Return()
+		} else {
+			notice.Text = notice.tr("Access denied.")
+		}
+		MainTasker.Add(nil, notice.SendMessageWrapperTask, &notice)
+		message.Text = sprintf("%s %d", map[bool]string{true: "✅", false: "❌"}[approved], id)
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	}
+	cmds.Add(commandAccessApprove, "🛡approve", false, false, adminOnly(func(message Message, usr *botUser) {
+		answer(message, true)
+	}, MainTasker))
+	cmds.Add(commandAccessDeny, "🛡deny", false, false, adminOnly(func(message Message, usr *botUser) {
+		answer(message, false)
+	}, MainTasker))
+	cmds.Add(commandAdminInvite, "🛡invite", false, false, adminOnly(func(message Message, usr *botUser) {
+		code := newInviteCode()
+		obj.Db.FindCreate("invites").Put(code, usr.Sid)
+		message.Text = message.tr("One-time invite") + ":\n"
+		if name := getBotName(); name != "" {
+			message.Text += "https://t.me/" + name + "?start=" + code + "\n"
+		}
+		message.Text += "<code>/" + commandStart + " " + code + "</code>"
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	}, MainTasker))
+}
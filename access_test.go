@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_checkAccessMode(t *testing.T) {
+	some := map[int64]bool{1: true}
+	for _, tt := range []struct {
+		mode   string
+		admins map[int64]bool
+		ok     bool
+	}{
+		{accessOpen, nil, true},
+		{accessAllowlist, nil, true},
+		{accessInvite, nil, false},
+		{accessApproval, map[int64]bool{}, false},
+		{accessApproval, some, true},
+	} {
+		if err := checkAccessMode(tt.mode, tt.admins); (err == nil) != tt.ok {
+			t.Errorf("checkAccessMode(%s, %v) = %v", tt.mode, tt.admins, err)
+		}
+	}
+}
+
+func Test_botUser_redeemInvite(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "invite"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	defer func(v string) { accessMode = v }(accessMode)
+	accessMode = accessInvite
+	db.FindCreate("invites").Put("code", "1")
+	first, second := new(botUser).New(db, 10), new(botUser).New(db, 11)
+	if first.redeemInvite("") || first.redeemInvite("wrong") || first.accessAllowed() {
+		t.Fatal("access without code")
+	}
+	if !first.redeemInvite("code") || !first.accessAllowed() {
+		t.Errorf("code is not redeemed")
+	}
+	if second.redeemInvite("code") || second.accessAllowed() {
+		t.Errorf("code is redeemed twice")
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	webm = ".webm"
+	mkv  = ".mkv"
+	// adaptive streams are downloaded to temporary files before merge
+	adaptiveVideo = ".video"
+	adaptiveAudio = ".audio"
+)
+
+// videoResolutions - heights of adaptive video mode in quality menu
+var videoResolutions = []string{"480", "720", "1080", "1440"}
+
+// adaptiveHeight(string) int
+// maximal height of adaptive video mode, 0 for itag of progressive or audio stream
+func adaptiveHeight(itag string) int {
+	if !slices.Contains(videoResolutions, itag) {
+		return 0
+	}
+	h, _ := strconv.Atoi(itag)
+	return h
+}
+
+// isVideoExt(string) bool
+// extension of video result
+func isVideoExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case mp4, webm, mkv:
+		return true
+	}
+	return false
+}
+
+// mimeCodec(string) string
+// first codec of mime type like 'video/mp4; codecs="avc1.640028"'
+func mimeCodec(mime string) string {
+	_, codecs, _ := strings.Cut(mime, `codecs="`)
+	codec, _, _ := strings.Cut(strings.TrimSuffix(codecs, `"`), ",")
+	return strings.TrimSpace(codec)
+}
+
+// codecRank(string) int
+// video codec preference: MP4 with H.264 is played by all telegram clients
+func codecRank(codec string) int {
+	switch {
+	case strings.HasPrefix(codec, "avc1"):
+		return 3
+	case strings.HasPrefix(codec, "av01"):
+		return 2
+	case strings.HasPrefix(codec, "vp9"), strings.HasPrefix(codec, "vp09"):
+		return 1
+	}
+	return 0
+}
+
+// mimeContainer(string) string
+// container of stream: mp4 or webm
+func mimeContainer(mime string) string {
+	kind, _, _ := strings.Cut(mime, ";")
+	_, container, _ := strings.Cut(kind, "/")
+	return container
+}
+
+// pickAdaptive(youtube.FormatList, int) (*youtube.Format, *youtube.Format)
+// best video only stream not higher than height and best audio stream for it, nil if not found
+func pickAdaptive(list youtube.FormatList, height int) (*youtube.Format, *youtube.Format) {
+	var video, audio *youtube.Format
+	betterVideo := func(f *youtube.Format) bool {
+		switch {
+		case f.Height != video.Height:
+			return f.Height > video.Height
+		case codecRank(mimeCodec(f.MimeType)) != codecRank(mimeCodec(video.MimeType)):
+			return codecRank(mimeCodec(f.MimeType)) > codecRank(mimeCodec(video.MimeType))
+		}
+		return f.Bitrate > video.Bitrate
+	}
+	for k := range list {
+		f := &list[k]
+		if strings.HasPrefix(f.MimeType, "video/") && f.AudioChannels == 0 && f.Height > 0 && f.Height <= height && (video == nil || betterVideo(f)) {
+			video = f
+		}
+	}
+	if video == nil {
+		return nil, nil
+	}
+	audio = pickAdaptiveAudio(list, video)
+	if audio == nil {
+		return nil, nil
+	}
+	return video, audio
+}
+
+// pickAdaptiveAudio(youtube.FormatList, *youtube.Format) *youtube.Format
+// best audio stream for video only stream, nil if not found
+func pickAdaptiveAudio(list youtube.FormatList, video *youtube.Format) *youtube.Format {
+	var audio *youtube.Format
+	// audio in container of video is merged without MKV
+	same := func(f *youtube.Format) bool { return mimeContainer(f.MimeType) == mimeContainer(video.MimeType) }
+	betterAudio := func(f *youtube.Format) bool {
+		if same(f) != same(audio) {
+			return same(f)
+		}
+		return f.Bitrate > audio.Bitrate
+	}
+	for k := range list {
+		f := &list[k]
+		if f.AudioTrack != nil && !f.AudioTrack.AudioIsDefault {
+			continue // dubbed track
+		}
+		if strings.HasPrefix(f.MimeType, "audio/") && (audio == nil || betterAudio(f)) {
+			audio = f
+		}
+	}
+	return audio
+}
+
+// mergeContainer(string, string) string
+// extension of merged file: MP4 if both streams are MP4, WebM if both are WebM, else MKV
+func mergeContainer(videoMime, audioMime string) string {
+	v, a := mimeContainer(videoMime), mimeContainer(audioMime)
+	switch {
+	case v == "mp4" && a == "mp4":
+		return mp4
+	case v == "webm" && a == "webm":
+		return webm
+	}
+	return mkv
+}
+
+// streamSize(*youtube.Format, time.Duration) int64
+// size of stream, estimated by bitrate if unknown
+func streamSize(f *youtube.Format, d time.Duration) int64 {
+	if f.ContentLength > 0 {
+		return f.ContentLength
+	}
+	bitrate := f.AverageBitrate
+	if bitrate == 0 {
+		bitrate = f.Bitrate
+	}
+	return int64(d.Seconds() * float64(bitrate) / 8)
+}
+
+// videoExt() string
+// extension of video result
+func (v *JsonPls) videoExt() string {
+	if v.Container != "" {
+		return v.Container
+	}
+	return mp4
+}
+
+// startAdaptive(*Tasker, *JsonPls, *youtube.Client, *youtube.Video, *youtube.Format, *youtube.Format, *botUser, *Message) bool
+// reserve quota for chosen streams and queue download, false if download is not queued
+func (o *Query) startAdaptive(T *Tasker, v *JsonPls, client *youtube.Client, video *youtube.Video, vf, af *youtube.Format, usr *botUser, message *Message) bool {
+	size := streamSize(vf, video.Duration) + streamSize(af, video.Duration)
+	if v.Clip != nil {
+		size = v.Clip.part(size, video.Duration)
+	}
+	if reason := v.Hold.reserve(usr, Quota{Bytes: size}); reason != "" {
+		v.Reason = "quota: " + reason
+		v.toLog(v.Reason, true)
+		o.quotaExceeded(T, reason, message)
+		return false
+	}
+	var err error
+	if v.URLDl, err = client.GetStreamURL(video, vf); err != nil {
+		v.toLog(err.Error(), true)
+		return false
+	}
+	if v.URLDlAudio, err = client.GetStreamURL(video, af); err != nil {
+		v.toLog(err.Error(), true)
+		return false
+	}
+	v.Size = size
+	v.Container = mergeContainer(vf.MimeType, af.MimeType)
+	m := *message
+	m.ReplyMarkup = Buttons{}
+	m.DelAfter = false
+	m.Text = "🎬 " + html.EscapeString(v.Artist+" ["+v.Song+"]") + sprintf(": %s %s + %s, %s ≈ %.1f MB", vf.QualityLabel, mimeCodec(vf.MimeType), mimeCodec(af.MimeType), strings.TrimPrefix(v.Container, "."), float64(size)/(1<<20))
+	m.extensionMessaging(T, sendParam, false, m.sendMessage)
+	T.Add(v, o.DownloadJpgWrapperTask, message)
+	T.Add(v, o.DownloadAdaptiveWrapperTask, message)
+	return true
+}
+
+// downloadStream(*Tasker, string, string) error
+// download stream by parts without progress message
+func downloadStream(T *Tasker, from, to string) error {
+	pr, pw := io.Pipe()
+	counter := &WriteCounter{Tasker: T, PartSize: partSize, File: initScrFile(to, from), Done: make(chan bool, 1)}
+	go load(from, pw, 0, counter)
+	written, err := io.Copy(counter.File.File, pr)
+	counter.File.File.Close()
+	if err == nil && written == 0 {
+		err = errors.New("empty stream " + to)
+	}
+	return err
+}
+
+// DownloadAdaptiveWrapperTask(*Tasker, Thing, *Message)
+// download video and audio streams at the same time and merge them without re-encoding
+func (o *Query) DownloadAdaptiveWrapperTask(T *Tasker, task Thing, message *Message) {
+	defer new(Timer).Start().Stop()
+	v := task.Input.(*JsonPls)
+	defer v.done()
+	usr := GetCtx[*botUser](T, userParam, message)
+	var err error
+	if v.Clip != nil {
+		// ffmpeg seeks remote streams, only part of clip is downloaded
+		err = mergeStreams(v, v.URLDl, v.URLDlAudio)
+	} else {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for k, s := range [][2]string{{v.URLDl, adaptiveVideo}, {v.URLDlAudio, adaptiveAudio}} {
+			wg.Add(1)
+			go func(k int, from, to string) {
+				defer wg.Done()
+				errs[k] = downloadStream(T, from, to)
+			}(k, s[0], v.URLSaved+s[1])
+		}
+		wg.Wait()
+		defer os.Remove(v.URLSaved + adaptiveVideo)
+		defer os.Remove(v.URLSaved + adaptiveAudio)
+		if v.Size == 0 {
+			usr.addUsage(Quota{Bytes: fileSize(v.URLSaved+adaptiveVideo) + fileSize(v.URLSaved+adaptiveAudio)})
+		}
+		select {
+		case <-T.Branch.Context.Done():
+			return
+		default:
+		}
+		if err = errors.Join(errs...); err == nil {
+			err = mergeStreams(v, v.URLSaved+adaptiveVideo, v.URLSaved+adaptiveAudio)
+		}
+	}
+	out := v.URLSaved + v.videoExt()
+	message.AddCtx(T, out, err == nil)
+	if err != nil {
+		v.toLog(err.Error(), true)
+		m := *message
+		m.ReplyMarkup = Buttons{}
+		m.DelAfter = false
+		m.Text = infoLabel + m.tr("Video was not merged") + ": " + html.EscapeString(v.Artist+" ["+v.Song+"]")
+		m.extensionMessaging(T, sendParam, false, m.sendMessage)
+		return
+	}
+	v.Hold.keep()
+	v.toLog(v.videoExt() + " merged")
+	if !debug && !v.Ordered {
+		sendFiles(T, task, v.videoExt(), message)
+	}
+}
+
+// mergeStreams(*JsonPls, string, string) error
+// mux video and audio streams (files or URLs) with title tags, clip is cut exactly with re-encoding
+func mergeStreams(v *JsonPls, video, audio string) error {
+	var args []string
+	for _, in := range []string{video, audio} {
+		if v.Clip != nil {
+			args = append(args, "-ss")
+			args = append(args, sprintf("%.3f", v.Clip.Start.Seconds()))
+			if v.Clip.End != 0 {
+				args = append(args, "-to")
+				args = append(args, sprintf("%.3f", v.Clip.End.Seconds()))
+			}
+		}
+		args = append(args, "-i")
+		args = append(args, in)
+	}
+	args = append(args, "-map")
+	args = append(args, "0:v:0")
+	args = append(args, "-map")
+	args = append(args, "1:a:0")
+	if v.Clip != nil {
+		args = append(args, "-c:v")
+		args = append(args, "libx264")
+		args = append(args, "-preset")
+		args = append(args, "veryfast")
+		args = append(args, "-c:a")
+		args = append(args, "aac")
+		args = append(args, "-b:a")
+		args = append(args, "192k")
+		v.Container = mp4
+	} else {
+		args = append(args, "-c")
+		args = append(args, "copy")
+	}
+	if v.videoExt() == mp4 {
+		args = append(args, "-movflags")
+		args = append(args, "+faststart")
+	}
+	for k, val := range trackTags(v) {
+		args = append(args, "-metadata")
+		args = append(args, k+"="+val)
+	}
+	args = append(args, "-y")
+	args = append(args, v.URLSaved+v.videoExt())
+	out, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return errors.New("ffmpeg: " + lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func Test_pickAdaptive(t *testing.T) {
+	list := youtube.FormatList{
+		{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Height: 360, AudioChannels: 2, Bitrate: 500000},
+		{ItagNo: 137, MimeType: `video/mp4; codecs="avc1.640028"`, Height: 1080, Bitrate: 4000000},
+		{ItagNo: 248, MimeType: `video/webm; codecs="vp9"`, Height: 1080, Bitrate: 2600000},
+		{ItagNo: 136, MimeType: `video/mp4; codecs="avc1.4d401f"`, Height: 720, Bitrate: 2000000},
+		{ItagNo: 247, MimeType: `video/webm; codecs="vp9"`, Height: 720, Bitrate: 1500000},
+		{ItagNo: 271, MimeType: `video/webm; codecs="vp9"`, Height: 1440, Bitrate: 9000000},
+		{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, AudioChannels: 2, Bitrate: 130000},
+		{ItagNo: 251, MimeType: `audio/webm; codecs="opus"`, AudioChannels: 2, Bitrate: 140000},
+	}
+	for _, tt := range []struct {
+		height       int
+		video, audio int
+		ext          string
+	}{
+		{1440, 271, 251, webm},
+		{1080, 137, 140, mp4},
+		{720, 136, 140, mp4},
+		{480, 0, 0, ""},
+	} {
+		video, audio := pickAdaptive(list, tt.height)
+		if tt.video == 0 {
+			if video != nil || audio != nil {
+				t.Errorf("pickAdaptive(%d) = %v, %v, want nil", tt.height, video, audio)
+			}
+			continue
+		}
+		if video == nil || audio == nil || video.ItagNo != tt.video || audio.ItagNo != tt.audio {
+			t.Errorf("pickAdaptive(%d) = %v, %v, want itags %d, %d", tt.height, video, audio, tt.video, tt.audio)
+			continue
+		}
+		if ext := mergeContainer(video.MimeType, audio.MimeType); ext != tt.ext {
+			t.Errorf("mergeContainer(%d) = %s, want %s", tt.height, ext, tt.ext)
+		}
+	}
+	if ext := mergeContainer(`video/webm; codecs="vp9"`, `audio/mp4; codecs="mp4a.40.2"`); ext != mkv {
+		t.Errorf("mergeContainer(webm, mp4) = %s, want %s", ext, mkv)
+	}
+}
+
+func Test_adaptiveHelpers(t *testing.T) {
+	if adaptiveHeight("1080") != 1080 || adaptiveHeight("140") != 0 || adaptiveHeight("22") != 0 {
+		t.Errorf("adaptiveHeight() is wrong")
+	}
+	if got := mimeCodec(`video/mp4; codecs="avc1.42001E, mp4a.40.2"`); got != "avc1.42001E" {
+		t.Errorf("mimeCodec() = %q", got)
+	}
+	f := &youtube.Format{Bitrate: 8000}
+	if got := streamSize(f, 10*time.Second); got != 10000 {
+		t.Errorf("streamSize() = %d, want 10000", got)
+	}
+	f.ContentLength = 5
+	if got := streamSize(f, 10*time.Second); got != 5 {
+		t.Errorf("streamSize() = %d, want 5", got)
+	}
+	if !isVideoExt(".MKV") || isVideoExt(mp3) {
+		t.Errorf("isVideoExt() is wrong")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseAdmins(string) map[int64]bool
+// admin chat IDs from env value like "123,456"
+func parseAdmins(list string) map[int64]bool {
+	ret := make(map[int64]bool)
+	for _, v := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			toLog("wrong admin id", v)
+			continue
+		}
+		ret[id] = true
+	}
+	return ret
+}
+
+// adminOnly(func(Message, *botUser), *Tasker) func(Message, *botUser)
+// command wrapper. Not admins get same answer as for unknown command
+func adminOnly(f func(Message, *botUser), MainTasker *Tasker) func(Message, *botUser) {
+	return func(message Message, usr *botUser) {
+		if !usr.isAdmin() {
+			message.Text = "<i>" + message.Command + "</i> - " + message.tr("Fail operation. Try again, please.")
+			message.DelBefore = true
+			message.DelAfter = true
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		f(message, usr)
+	}
+}
+
+// commandArgument(Message, string) string
+// text after command name
+func commandArgument(message Message, name string) string {
+	return strings.TrimSpace(strings.TrimPrefix(message.Command, "/"+name))
+}
+
+// targetUser(Message, string) (*botUser, bool)
+// user from command argument with chat ID
+func (obj *Action) targetUser(message Message, name string) (*botUser, bool) {
+	id, err := strconv.ParseInt(commandArgument(message, name), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return new(botUser).New(obj.Db, id), true
+}
+
+// addAdminCommands(*Commands, *Tasker)
+// admin commands. Not added to reply keyboard
+func (obj *Action) addAdminCommands(cmds *Commands, MainTasker *Tasker) {
+	reply := func(message Message, text string) {
+		message.Text = text
+		message.DelBefore = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	}
+	cmds.Add(commandAdminHelp, "🛡admin", false, false, adminOnly(func(message Message, usr *botUser) {
+		reply(message, "/"+commandAdminUsers+" - "+message.tr("subscribed users")+"\n"+
+			"/"+commandAdminJobs+" - "+message.tr("active jobs")+"\n"+
+			"/"+commandAdminBan+" &lt;id&gt; - "+message.tr("ban chat")+"\n"+
+			"/"+commandAdminUnban+" &lt;id&gt; - "+message.tr("unban chat")+"\n"+
+			"/"+commandAdminKick+" &lt;id&gt; - "+message.tr("force unsubscribe")+"\n"+
+			"/"+commandAdminBroadcast+" &lt;text&gt; - "+message.tr("message to all subscribers")+"\n"+
+			"/"+commandAdminInvite+" - "+message.tr("one-time invite link"))
+	}, MainTasker))
+	cmds.Add(commandAdminUsers, "🛡users", false, false, adminOnly(func(message Message, usr *botUser) {
+		names := cmds.GetAllUsers()
+		type row struct {
+			id   int64
+			text string
+			last time.Time
+		}
+		var rows []row
+		for _, id := range obj.Db.userIDs() {
+			u := new(botUser).New(obj.Db, id)
+			if !sBool(u.getParameter(paramParam, Subscribe)) && !sBool(u.getParameter(paramParam, paramBanned)) {
+				continue
+			}
+			r := row{id: id, last: u.lastActivity()}
+			r.text = sprintf("<code>%d</code> @%s", id, html.EscapeString(names[u.Sid]))
+			if !r.last.IsZero() {
+				r.text += " " + r.last.Format("2006-01-02 15:04")
+			}
+			if sBool(u.getParameter(paramParam, paramBanned)) {
+				r.text += " 🚫"
+			}
+			if n := len(obj.Jobs.ByChat(id)); n > 0 {
+				r.text += sprintf(" ⚙%d", n)
+			}
+			rows = append(rows, r)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].last.After(rows[j].last) })
+		text := message.tr("Users") + sprintf(": %d\n", len(rows))
+		for _, r := range rows {
+			text += r.text + "\n"
+		}
+		reply(message, text)
+	}, MainTasker))
+	cmds.Add(commandAdminJobs, "🛡jobs", false, false, adminOnly(func(message Message, usr *botUser) {
+		jobs := obj.Jobs.List()
+		text := message.tr("Active jobs") + sprintf(": %d\n", len(jobs))
+		for _, v := range jobs {
+			text += sprintf("<code>%d</code> @%s %s %s\n", v.ChatID, html.EscapeString(v.User), html.EscapeString(v.Link), time.Since(v.Started).Round(time.Second))
+		}
+		reply(message, text)
+	}, MainTasker))
+	cmds.Add(commandAdminBan, "🛡ban", false, false, adminOnly(func(message Message, usr *botUser) {
+		target, ok := obj.targetUser(message, commandAdminBan)
+		if !ok {
+			reply(message, infoLabel+"/"+commandAdminBan+" &lt;id&gt;")
+			return
+		}
+		target.setParameter(paramParam, paramBanned, true)
+		target.setParameter(paramParam, Subscribe, false)
+		canceled := obj.Jobs.Cancel(target.Id)
+		reply(message, sprintf("🚫 %d (%s: %d)", target.Id, message.tr("canceled jobs"), canceled))
+	}, MainTasker))
+	cmds.Add(commandAdminUnban, "🛡unban", false, false, adminOnly(func(message Message, usr *botUser) {
+		target, ok := obj.targetUser(message, commandAdminUnban)
+		if !ok {
+			reply(message, infoLabel+"/"+commandAdminUnban+" &lt;id&gt;")
+			return
+		}
+		target.setParameter(paramParam, paramBanned, false)
+		reply(message, sprintf("🆗 %d", target.Id))
+	}, MainTasker))
+	cmds.Add(commandAdminKick, "🛡kick", false, false, adminOnly(func(message Message, usr *botUser) {
+		target, ok := obj.targetUser(message, commandAdminKick)
+		if !ok {
+			reply(message, infoLabel+"/"+commandAdminKick+" &lt;id&gt;")
+			return
+		}
+		target.setParameter(paramParam, Subscribe, false)
+		canceled := obj.Jobs.Cancel(target.Id)
+		notice := Message{}
+		notice.ChatID = target.Id
+		notice.ParseMode = htmlMode
+		notice.LanguageCode = message.LanguageCode
+		notice.Text = notice.tr("You are unsubscribed.")
+		notice.ReplyMarkup = new(Buttons).NewLine().Add("/" + commandStart).Return()
+		MainTasker.Add(nil, notice.SendMessageWrapperTask, &notice)
+		reply(message, sprintf("🔵 %d (%s: %d)", target.Id, message.tr("canceled jobs"), canceled))
+	}, MainTasker))
+	cmds.Add(commandAdminBroadcast, "🛡broadcast", false, false, adminOnly(func(message Message, usr *botUser) {
+		text := commandArgument(message, commandAdminBroadcast)
+		if text == "" {
+			reply(message, infoLabel+"/"+commandAdminBroadcast+" &lt;text&gt;")
+			return
+		}
+		sent, failed := 0, 0
+		limit := time.NewTicker(broadcastDelay)
+		defer limit.Stop()
+		for _, id := range obj.Db.userIDs() {
+			u := new(botUser).New(obj.Db, id)
+			if !sBool(u.getParameter(paramParam, Subscribe)) || sBool(u.getParameter(paramParam, paramBanned)) {
+				continue
+			}
+			<-limit.C
+			m := Message{}
+			m.ChatID = id
+			m.ParseMode = htmlMode
+			m.Text = html.EscapeString(text)
+			if m.sendMessage(MainTasker, sendParam) != 0 {
+				sent++
+			} else {
+				failed++
+			}
+		}
+		reply(message, sprintf("📣 %s: %d, %s: %d", message.tr("sent"), sent, message.tr("failed"), failed))
+	}, MainTasker))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mediaGroupSize - telegram limit of files in one media group
+const mediaGroupSize = 10
+
+// AlbumInfo - playlist information for album tags
+type AlbumInfo struct {
+	Title  string
+	Artist string
+	Covers []string // thumbnails of playlist, biggest first
+}
+
+// albumMode(*botUser) bool
+// playlists are sent as albums, works only with audio conversion
+func albumMode(usr *botUser) bool {
+	return sBool(usr.getParameter(paramParam, commandSettingsAlbum)) && sBool(usr.getParameter(paramParam, mp3))
+}
+
+// setAlbumMode(*botUser)
+// album is sent in playlist order whatever sort user chose
+func (o *Query) setAlbumMode(usr *botUser) {
+	o.AlbumMode = albumMode(usr)
+	if o.AlbumMode {
+		o.SortBy, o.SortReverse = sortPlaylist, false
+	}
+}
+
+// albumSender - collect ready tracks and send them as media groups
+type albumSender struct {
+	T       *Tasker
+	Message *Message
+	Format  AudioFormat
+	Group   []*JsonPls
+}
+
+// add(*JsonPls)
+// add track to group, full group is sent
+func (o *albumSender) add(v *JsonPls) {
+	if fileSize(v.URLSaved+o.Format.Ext) >= limitFileTelegram || len(v.Parts) > 0 {
+		// too big for group, will be split
+		sendFiles(o.T, Thing{Input: v}, o.Format.Ext, o.Message)
+		return
+	}
+	o.Group = append(o.Group, v)
+	if len(o.Group) == mediaGroupSize {
+		o.flush()
+	}
+}
+
+// flush()
+// send collected tracks
+func (o *albumSender) flush() {
+	defer func() { o.Group = nil }()
+	switch len(o.Group) {
+	case 0:
+		return
+	case 1:
+		sendFiles(o.T, Thing{Input: o.Group[0]}, o.Format.Ext, o.Message)
+		return
+	}
+	var files []DocumentMessage
+	for _, v := range o.Group {
+		files = append(files, DocumentMessage{Src: v.URLSaved + o.Format.Ext, Title: v.Artist + " [" + v.Song + "]", Check: true})
+	}
+	typeFile := "document"
+	if o.Format.Audio {
+		typeFile = "audio"
+	}
+	if !o.Message.sendMediaGroup(files, typeFile) {
+		for _, v := range o.Group {
+			sendFiles(o.T, Thing{Input: v}, o.Format.Ext, o.Message)
+		}
+		return
+	}
+	for _, v := range o.Group {
+		removeTrackFiles(v, o.Format.Ext)
+	}
+	<-time.After(1 * time.Second)
+}
+
+// removeTrackFiles(*JsonPls, string)
+// delete sent audio with source video and cover
+func removeTrackFiles(v *JsonPls, ext string) {
+	if debug {
+		return
+	}
+	for _, e := range []string{ext, mp4, jpg} {
+		os.Remove(v.URLSaved + e)
+	}
+	os.Remove(filepath.Dir(v.URLSaved)) // only if empty
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// minChapters, minChapterLength - rules of YouTube for chapters
+	minChapters      = 3
+	minChapterLength = 10 * time.Second
+	// chapterWebDuration - shorter videos are not checked for chapters on watch page
+	chapterWebDuration = 10 * time.Minute
+	chaptersFolder     = "chapters"
+)
+
+// Chapter - part of long video
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration // 0 - till the end of video
+}
+
+var (
+	reChapterTime  = regexp.MustCompile(`(?:^|[^\d:])((?:(\d{1,2}):)?(\d{1,2}):(\d{2}))(?:$|[^\d:])`)
+	reChapterEmpty = regexp.MustCompile(`[(\[]\s*[)\]]`)
+	reChapterTrim  = regexp.MustCompile(`^(?:\d{1,3}[.)]\s+)?[\s\-–—:|.]*|[\s\-–—:|]+$`)
+	reChapterWeb   = regexp.MustCompile(`"chapterRenderer":\{"title":\{"simpleText":"((?:[^"\\]|\\.)*)"\},"timeRangeStartMillis":(\d+)`)
+	reChapterTimes = regexp.MustCompile(`(?:\d{1,2}:)?\d{1,2}:\d{2}`)
+)
+
+// chaptersMode(*botUser) bool
+// long videos are cut by chapters, works only with audio conversion
+func chaptersMode(usr *botUser) bool {
+	return sBool(usr.getParameter(paramParam, commandSettingsChapters)) && sBool(usr.getParameter(paramParam, mp3))
+}
+
+// parseChapterTime(string, string, string) time.Duration
+// groups of reChapterTime: hours (may be empty), minutes, seconds
+func parseChapterTime(h, m, s string) time.Duration {
+	hours, _ := strconv.Atoi(h)
+	minutes, _ := strconv.Atoi(m)
+	seconds, _ := strconv.Atoi(s)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+}
+
+// parseChapters(string, time.Duration) []Chapter
+// chapters from "00:00 Title" lines of description, nil if lines are not chapters
+func parseChapters(description string, total time.Duration) []Chapter {
+	var ret []Chapter
+	for _, line := range strings.Split(description, "\n") {
+		m := reChapterTime.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start := parseChapterTime(m[2], m[3], m[4])
+		if len(ret) == 0 && start != 0 {
+			continue // chapters start from 0:00, earlier lines are text
+		}
+		title := reChapterEmpty.ReplaceAllString(reChapterTimes.ReplaceAllString(line, " "), "")
+		title = strings.TrimSpace(reChapterTrim.ReplaceAllString(reSpaces.ReplaceAllString(title, " "), ""))
+		ret = append(ret, Chapter{Title: title, Start: start})
+	}
+	return checkChapters(ret, total)
+}
+
+// parseWebChapters(string, time.Duration) []Chapter
+// chapters from watch page (player markers), used if description has no timestamps
+func parseWebChapters(page string, total time.Duration) []Chapter {
+	var ret []Chapter
+	for _, m := range reChapterWeb.FindAllStringSubmatch(page, -1) {
+		title, err := strconv.Unquote(`"` + m[1] + `"`)
+		if err != nil {
+			title = m[1]
+		}
+		ms, _ := strconv.ParseInt(m[2], 10, 64)
+		start := time.Duration(ms) * time.Millisecond
+		if len(ret) > 0 && start <= ret[len(ret)-1].Start {
+			break // chapters are repeated in page for other players
+		}
+		ret = append(ret, Chapter{Title: title, Start: start})
+	}
+	return checkChapters(ret, total)
+}
+
+// checkChapters([]Chapter, time.Duration) []Chapter
+// set ends, drop list which breaks rules of chapters
+func checkChapters(list []Chapter, total time.Duration) []Chapter {
+	if len(list) < minChapters || list[0].Start != 0 {
+		return nil
+	}
+	for k := range list {
+		if k+1 < len(list) {
+			list[k].End = list[k+1].Start
+		} else if total > list[k].Start {
+			list[k].End = total
+		}
+		if list[k].End != 0 && list[k].End-list[k].Start < minChapterLength {
+			return nil
+		}
+		if list[k].Title == "" {
+			list[k].Title = sprintf("Chapter %d", k+1)
+		}
+	}
+	return list
+}
+
+// webChapters(string, time.Duration) []Chapter
+// download watch page and find chapters
+func webChapters(id string, total time.Duration) []Chapter {
+	req, err := http.NewRequest(http.MethodGet, "https://www.youtube.com/watch?v="+id, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Accept-Language", "en")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		toLog(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		toLog(err)
+		return nil
+	}
+	return parseWebChapters(string(page), total)
+}
+
+// chapterTrack(*JsonPls, int, []Chapter) *JsonPls
+// tags of chapter: video is album, chapter is track
+func chapterTrack(v *JsonPls, k int, list []Chapter) *JsonPls {
+	artist, song := normalizeTrack(v.Artist, list[k].Title, nil)
+	part := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: v.ID, Artist: artist, Song: song}}
+	part.URL = v.URL
+	part.Album = v.Song
+	part.AlbumArtist = v.Artist
+	part.Year = v.Year
+	part.Date = v.Date
+	part.Genre = v.Genre
+	part.Label = v.Label
+	part.Track = k + 1
+	part.TrackTotal = len(list)
+	return part
+}
+
+// SplitChapters(*Tasker, *JsonPls, AudioFormat, string) []*JsonPls
+// cut converted audio by chapters, every part keeps cover and gets own tags
+func SplitChapters(T *Tasker, v *JsonPls, format AudioFormat, template string) []*JsonPls {
+	defer new(Timer).Start().Stop()
+	folder := filepath.Join(filepath.Dir(v.URLSaved), chaptersFolder)
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		v.toLog(err.Error(), true)
+		return nil
+	}
+	var parts []*JsonPls
+	for k, c := range v.Chapters {
+		select {
+		case <-T.Branch.Context.Done():
+			return nil
+		default:
+		}
+		part := chapterTrack(v, k, v.Chapters)
+		part.URLSaved = filepath.Join(folder, fileName(part, template))
+		if existFile(part.URLSaved+format.Ext) != "" {
+			part.URLSaved += sprintf(" (%d)", k+1) // equal chapter names
+		}
+		var args []string
+		args = append(args, "-ss")
+		args = append(args, sprintf("%.3f", c.Start.Seconds()))
+		if c.End != 0 {
+			args = append(args, "-to")
+			args = append(args, sprintf("%.3f", c.End.Seconds()))
+		}
+		args = append(args, "-i")
+		args = append(args, v.URLSaved+format.Ext)
+		args = append(args, "-map")
+		args = append(args, "0:a")
+		args = append(args, "-map_metadata")
+		args = append(args, "-1")
+		if format.Ext == mp3 {
+			args = append(args, "-write_id3v1")
+			args = append(args, "0")
+		}
+		args = append(args, "-c")
+		args = append(args, "copy")
+		args = append(args, "-y")
+		args = append(args, part.URLSaved+format.Ext)
+		err := exec.Command("ffmpeg", args...).Run()
+		if err == nil {
+			err = writeTrackTags(part.URLSaved+format.Ext, trackTags(part), v.URLSaved+jpg)
+		}
+		if err != nil {
+			v.toLog(sprintf("chapter %d: %s", k+1, err.Error()), true)
+			os.RemoveAll(folder)
+			return nil
+		}
+		parts = append(parts, part)
+	}
+	v.toLog(sprintf("%s split to %d chapters", format.Ext, len(parts)))
+	return parts
+}
+
+// sendChapters(*Tasker, *JsonPls, string, *Message)
+// send chapters as numbered set, then remove source files
+func sendChapters(T *Tasker, v *JsonPls, ext string, message *Message) {
+	user := GetCtx[*botUser](T, userParam, message)
+	for _, part := range v.Parts {
+		select {
+		case <-T.Branch.Context.Done():
+			return
+		default:
+		}
+		if fileSize(part.URLSaved+ext) >= limitFileTelegram {
+			part.Ordered = true
+			sendFiles(T, Thing{Input: part}, ext, message)
+			continue
+		}
+		param := DocumentMessage{}
+		param.Src = part.URLSaved + ext
+		param.Check = sBool(user.getParameter(paramParam, mp3))
+		param.Title = sprintf("%d/%d ", part.Track, part.TrackTotal) + part.Artist + " [" + part.Song + "]"
+		param.User = user
+		param.VideoID = v.ID
+		message.sendDocument(T, param)
+		<-time.After(1 * time.Second)
+	}
+	if !debug {
+		os.Remove(filepath.Join(filepath.Dir(v.URLSaved), chaptersFolder)) // only if empty
+		removeTrackFiles(v, ext)
+	}
+}
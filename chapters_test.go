@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseChapters(t *testing.T) {
+	total := 20 * time.Minute
+	for _, tt := range []struct {
+		name string
+		desc string
+		want []Chapter
+	}{
+		{"plain", "Full album\n\n00:00 Intro\n03:15 - Second Song\n1. 07:40 Artist B - Third (Remix)\n\nThanks!", []Chapter{
+			{"Intro", 0, 3*time.Minute + 15*time.Second},
+			{"Second Song", 3*time.Minute + 15*time.Second, 7*time.Minute + 40*time.Second},
+			{"Artist B - Third (Remix)", 7*time.Minute + 40*time.Second, total},
+		}},
+		{"brackets and hours", "[0:00] One\n[0:59:30] Two\n(1:05:00) Three", []Chapter{
+			{"One", 0, 59*time.Minute + 30*time.Second},
+			{"Two", 59*time.Minute + 30*time.Second, 65 * time.Minute},
+			{"Three", 65 * time.Minute, 0}, // longer than known duration
+		}},
+		{"ranges", "0:00 - 2:00 A\n2:00 - 4:00 B\n4:00 - 6:00 C", []Chapter{
+			{"A", 0, 2 * time.Minute},
+			{"B", 2 * time.Minute, 4 * time.Minute},
+			{"C", 4 * time.Minute, total},
+		}},
+		{"text before", "Recorded at 12:30 live\n0:00 A\n5:00 B\n9:00\n", []Chapter{
+			{"A", 0, 5 * time.Minute},
+			{"B", 5 * time.Minute, 9 * time.Minute},
+			{"Chapter 3", 9 * time.Minute, total},
+		}},
+		{"no zero", "1:00 A\n2:00 B\n3:00 C", nil},
+		{"too few", "0:00 A\n2:00 B", nil},
+		{"too short", "0:00 A\n0:05 B\n3:00 C", nil},
+		{"no chapters", "Lyrics\nla la la", nil},
+	} {
+		if got := parseChapters(tt.desc, total); sprintf("%v", got) != sprintf("%v", tt.want) {
+			t.Errorf("%s: parseChapters() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_parseWebChapters(t *testing.T) {
+	chapter := func(title string, ms int) string {
+		return sprintf(`{"chapterRenderer":{"title":{"simpleText":"%s"},"timeRangeStartMillis":%d,"thumbnail":{}}}`, title, ms)
+	}
+	page := `var ytInitialData = {"markers":[` + chapter("Intro", 0) + "," + chapter(`Song \"One\"`, 60000) + "," + chapter(`Café`, 120500) +
+		`]},{"markers":[` + chapter("Intro", 0) + `]}`
+	want := []Chapter{
+		{"Intro", 0, time.Minute},
+		{`Song "One"`, time.Minute, 120500 * time.Millisecond},
+		{"Café", 120500 * time.Millisecond, 0},
+	}
+	if got := parseWebChapters(page, 0); sprintf("%v", got) != sprintf("%v", want) {
+		t.Errorf("parseWebChapters() = %v, want %v", got, want)
+	}
+	if got := parseWebChapters("<html></html>", time.Hour); got != nil {
+		t.Errorf("parseWebChapters(empty) = %v, want nil", got)
+	}
+}
+
+func Test_chapterTrack(t *testing.T) {
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc", Artist: "Band", Song: "Live at Home"}, Year: "2020"}
+	list := []Chapter{{Title: "Intro"}, {Title: "Guest - Duet"}}
+	part := chapterTrack(v, 1, list)
+	if part.Artist != "Guest" || part.Song != "Duet" || part.Album != "Live at Home" || part.AlbumArtist != "Band" || part.Track != 2 || part.TrackTotal != 2 || part.Year != "2020" {
+		t.Errorf("chapterTrack() = %+v", part)
+	}
+	if part = chapterTrack(v, 0, list); part.Artist != "Band" || part.Song != "Intro" {
+		t.Errorf("chapterTrack() = %s - %s, want Band - Intro", part.Artist, part.Song)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const commandClip = "clip"
+
+// clipHelp - usage of clips
+const clipHelp = `<b>Clip</b> - only part of video:
+<code>/clip https://youtu.be/... 1:20-2:05</code>
+<code>https://youtu.be/... 1:20-2:05</code>
+<code>https://youtu.be/...?t=80</code> - from 1:20 to the end
+<code>https://youtu.be/...?t=80 -2:05</code> - from 1:20 to 2:05
+Time: <code>80</code>, <code>1:20</code>, <code>1m20s</code>, <code>1:02:03</code>`
+
+var reURLTime = regexp.MustCompile(`[?&#]t=([0-9hms.]+)`)
+
+// ClipRange - part of video, End 0 - till the end
+type ClipRange struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// String() string
+// range like 1:20-2:05
+func (c ClipRange) String() string {
+	if c.End == 0 {
+		return formatDuration(c.Start) + "-"
+	}
+	return formatDuration(c.Start) + "-" + formatDuration(c.End)
+}
+
+// parseClipTime(string) (time.Duration, error)
+// seconds without unit are allowed
+func parseClipTime(s string) (time.Duration, error) {
+	if s != "" && strings.Trim(s, "0123456789") == "" {
+		s += "s"
+	}
+	if s == "0s" {
+		return 0, nil
+	}
+	return parseFilterDuration(s)
+}
+
+// parseClip(string) (*ClipRange, error)
+// range like "1:20-2:05", "80-", "-2:05", nil for empty text
+func parseClip(text string) (*ClipRange, error) {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), "")
+	if text == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(text, "-")
+	if !ok {
+		return nil, errors.New("wrong clip " + text + ", use start-end")
+	}
+	c := new(ClipRange)
+	var err error
+	if from != "" {
+		if c.Start, err = parseClipTime(from); err != nil {
+			return nil, err
+		}
+	}
+	if to != "" {
+		if c.End, err = parseClipTime(to); err != nil {
+			return nil, err
+		}
+		if c.End <= c.Start {
+			return nil, errors.New("clip end must be after start")
+		}
+	}
+	if c.Start == 0 && c.End == 0 {
+		return nil, errors.New("empty clip " + text)
+	}
+	return c, nil
+}
+
+// clipSelector(string, string) string
+// t= parameter of link is start of clip
+func clipSelector(link, selector string) string {
+	m := reURLTime.FindStringSubmatch(link)
+	if m == nil {
+		return selector
+	}
+	start := strings.TrimSuffix(m[1], ".")
+	switch {
+	case selector == "":
+		return start + "-"
+	case strings.HasPrefix(selector, "-"):
+		return start + selector
+	}
+	return selector
+}
+
+// fit(time.Duration) (*ClipRange, error)
+// range inside of video duration
+func (c ClipRange) fit(total time.Duration) (*ClipRange, error) {
+	if total == 0 {
+		return &c, nil
+	}
+	if c.Start >= total {
+		return nil, errors.New("clip starts after end of video " + formatDuration(total))
+	}
+	if c.End > total {
+		c.End = 0
+	}
+	return &c, nil
+}
+
+// length(time.Duration) time.Duration
+// duration of clip in video
+func (c ClipRange) length(total time.Duration) time.Duration {
+	if c.End == 0 {
+		return total - c.Start
+	}
+	return c.End - c.Start
+}
+
+// part(int64, time.Duration) int64
+// approximate size of clip in stream
+func (c ClipRange) part(size int64, total time.Duration) int64 {
+	if total <= 0 {
+		return size
+	}
+	return int64(float64(size) * float64(c.length(total)) / float64(total))
+}
+
+// DownloadClip(*Tasker, Thing, *Message)
+// download only range of stream: audio is copied, video is re-encoded for exact boundaries
+func DownloadClip(T *Tasker, task Thing, message *Message) {
+	defer new(Timer).Start().Stop()
+	v := task.Input.(*JsonPls)
+	select {
+	case <-T.Branch.Context.Done():
+		return
+	default:
+	}
+	var args []string
+	args = append(args, "-ss")
+	args = append(args, sprintf("%.3f", v.Clip.Start.Seconds()))
+	if v.Clip.End != 0 {
+		args = append(args, "-to")
+		args = append(args, sprintf("%.3f", v.Clip.End.Seconds()))
+	}
+	args = append(args, "-i")
+	args = append(args, v.URLDl)
+	if v.ClipVideo {
+		// copy cuts video only at keyframes
+		args = append(args, "-c:v")
+		args = append(args, "libx264")
+		args = append(args, "-preset")
+		args = append(args, "veryfast")
+		args = append(args, "-c:a")
+		args = append(args, "aac")
+		args = append(args, "-b:a")
+		args = append(args, "192k")
+	} else {
+		args = append(args, "-map")
+		args = append(args, "0:a")
+		args = append(args, "-c")
+		args = append(args, "copy")
+	}
+	args = append(args, "-y")
+	args = append(args, v.URLSaved+mp4)
+	err := exec.Command("ffmpeg", args...).Run()
+	if err != nil {
+		v.toLog("clip: "+err.Error(), true)
+		m := *message
+		m.ReplyMarkup = Buttons{}
+		m.DelAfter = false
+		m.Text = infoLabel + m.tr("Clip failed") + ": " + html.EscapeString(v.Artist+" ["+v.Song+"] "+v.Clip.String())
+		m.extensionMessaging(T, sendParam, false, m.sendMessage)
+	} else {
+		v.toLog("clip " + v.Clip.String())
+	}
+	message.AddCtx(T, v.URLSaved+mp4, err == nil)
+	if err == nil && !debug && !v.Ordered {
+		sendFiles(T, task, mp4, message)
+	}
+}
+
+// addClipCommands(*Commands, *Tasker)
+// command 'clip' without link shows usage, links are handled by find
+func (obj *Action) addClipCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandClip, "✂clip", false, false, func(message Message, usr *botUser) {
+		message.Text = clipHelp
+		message.DelBefore = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
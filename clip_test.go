@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseClip(t *testing.T) {
+	for _, tt := range []struct {
+		text    string
+		want    *ClipRange
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"1:20-2:05", &ClipRange{80 * time.Second, 125 * time.Second}, false},
+		{"1:20 - 2:05", &ClipRange{80 * time.Second, 125 * time.Second}, false},
+		{"80-", &ClipRange{80 * time.Second, 0}, false},
+		{"-2:05", &ClipRange{0, 125 * time.Second}, false},
+		{"1m20s-1:02:03", &ClipRange{80 * time.Second, time.Hour + 2*time.Minute + 3*time.Second}, false},
+		{"0-30", &ClipRange{0, 30 * time.Second}, false},
+		{"2:05-1:20", nil, true},
+		{"1:20", nil, true},
+		{"0-", nil, true},
+		{"a-b", nil, true},
+	} {
+		got, err := parseClip(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClip(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if sprintf("%v", got) != sprintf("%v", tt.want) {
+			t.Errorf("parseClip(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_clipSelector(t *testing.T) {
+	for _, tt := range []struct {
+		link, selector, want string
+	}{
+		{"!!!find!!!abcdefghijk", "1:20-2:05", "1:20-2:05"},
+		{"!!!find!!!abcdefghijk&t=80s", "", "80s-"},
+		{"!!!find!!!abcdefghijk?si=x&t=1m20s", "-2:05", "1m20s-2:05"},
+		{"!!!find!!!abcdefghijk?t=80", "0:10-0:20", "0:10-0:20"},
+	} {
+		if got := clipSelector(tt.link, tt.selector); got != tt.want {
+			t.Errorf("clipSelector(%q, %q) = %q, want %q", tt.link, tt.selector, got, tt.want)
+		}
+	}
+}
+
+func Test_ClipRange_fit(t *testing.T) {
+	total := 3 * time.Minute
+	c := ClipRange{Start: time.Minute, End: 5 * time.Minute}
+	got, err := c.fit(total)
+	if err != nil || got.End != 0 || got.length(total) != 2*time.Minute || got.String() != "1:00-" {
+		t.Errorf("fit() = %v, %v", got, err)
+	}
+	if _, err = (ClipRange{Start: 4 * time.Minute}).fit(total); err == nil {
+		t.Errorf("fit() must fail for start after end of video")
+	}
+	if size := (ClipRange{Start: time.Minute, End: 2 * time.Minute}).part(3000, total); size != 1000 {
+		t.Errorf("part() = %d, want 1000", size)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	commandCover = "cover"
+	paramCover   = "cover"
+	// coverQuality - JPEG quality of cover by default
+	coverQuality = 90
+	// borderTolerance - difference of channel (0-255) which is still the same color of bar
+	borderTolerance = 24
+	// borderShare - share of pixels of line with bar color, rest is noise of JPEG
+	borderShare = 0.97
+	// placeholderSize - side of generated cover
+	placeholderSize = 600
+	// placeholderChars, placeholderLines - text of generated cover
+	placeholderChars = 14
+	placeholderLines = 4
+	// coverMaxBytes - limit of downloaded thumbnail
+	coverMaxBytes = 10 << 20
+)
+
+// coverHelp - grammar of cover settings
+const coverHelp = `<b>Cover</b> settings (any order):
+<code>square</code> - center square crop, <code>full</code> - whole picture without bars
+<code>600</code> - size of longer side in pixels (64-2048), <code>0</code> - original size
+<code>q85</code> - JPEG quality (30-100)
+Example: <code>/cover square 600 q85</code>
+<code>/cover reset</code> - defaults`
+
+// Thumbnail - picture of video or playlist in YTv3 API
+type Thumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Thumbnails - all sizes of picture in YTv3 API, missing sizes have empty URL
+type Thumbnails struct {
+	Default  Thumbnail `json:"default"`
+	Medium   Thumbnail `json:"medium"`
+	High     Thumbnail `json:"high"`
+	Standard Thumbnail `json:"standard"`
+	Maxres   Thumbnail `json:"maxres"`
+}
+
+// urls() []string
+// existing sizes from biggest: maxres, standard, high, medium, default
+func (t Thumbnails) urls() []string {
+	var ret []string
+	for _, v := range []Thumbnail{t.Maxres, t.Standard, t.High, t.Medium, t.Default} {
+		if v.URL != "" {
+			ret = append(ret, v.URL)
+		}
+	}
+	return ret
+}
+
+// CoverSettings - processing of cover
+type CoverSettings struct {
+	Square  bool
+	Size    int // longer side, 0 - size of source
+	Quality int
+}
+
+// parseCoverSettings(string) (CoverSettings, error)
+// settings like "square 600 q85", defaults for empty text
+func parseCoverSettings(text string) (CoverSettings, error) {
+	ret := CoverSettings{Quality: coverQuality}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		switch {
+		case word == "square":
+			ret.Square = true
+		case word == "full":
+			ret.Square = false
+		case strings.HasPrefix(word, "q"):
+			n, err := strconv.Atoi(strings.TrimPrefix(word, "q"))
+			if err != nil || n < 30 || n > 100 {
+				return ret, errors.New("wrong quality " + word + ", use q30-q100")
+			}
+			ret.Quality = n
+		default:
+			n, err := strconv.Atoi(strings.TrimSuffix(word, "px"))
+			if err != nil {
+				return ret, errors.New("unknown cover setting " + word)
+			}
+			if n != 0 && (n < 64 || n > 2048) {
+				return ret, errors.New("wrong size " + word + ", use 64-2048")
+			}
+			ret.Size = n
+		}
+	}
+	return ret, nil
+}
+
+// String() string
+// settings in grammar of /cover
+func (c CoverSettings) String() string {
+	ret := "full"
+	if c.Square {
+		ret = "square"
+	}
+	return ret + sprintf(" %d q%d", c.Size, c.Quality)
+}
+
+// coverSettings() CoverSettings
+// cover settings of user
+func (o *botUser) coverSettings() CoverSettings {
+	c, err := parseCoverSettings(o.getParameter(paramParam, paramCover))
+	if err != nil {
+		c, _ = parseCoverSettings("")
+	}
+	return c
+}
+
+// lineColor(image.Image, image.Rectangle) ([3]float64, bool)
+// mean color of line and is line of one color
+func lineColor(img image.Image, r image.Rectangle) ([3]float64, bool) {
+	var mean [3]float64
+	n := float64(r.Dx() * r.Dy())
+	if n == 0 {
+		return mean, false
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			mean[0] += float64(c.R) / n
+			mean[1] += float64(c.G) / n
+			mean[2] += float64(c.B) / n
+		}
+	}
+	same := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if colorDistance(mean, [3]float64{float64(c.R), float64(c.G), float64(c.B)}) <= borderTolerance {
+				same++
+			}
+		}
+	}
+	return mean, float64(same) >= borderShare*n
+}
+
+// colorDistance([3]float64, [3]float64) float64
+// biggest difference of channels
+func colorDistance(a, b [3]float64) float64 {
+	return math.Max(math.Abs(a[0]-b[0]), math.Max(math.Abs(a[1]-b[1]), math.Abs(a[2]-b[2])))
+}
+
+// contentRect(image.Image) image.Rectangle
+// picture without letterbox (top, bottom) and pillarbox (left, right) bars. Bars are lines of one color on both sides with almost equal width
+func contentRect(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	r := b
+	// scan lines from edge while they have color of edge line, k stays in [lo, hi)
+	scan := func(from, to, step, lo, hi int, line func(int) image.Rectangle) int {
+		edge, ok := lineColor(img, line(from))
+		if !ok {
+			return from
+		}
+		k := from
+		for ; k != to && k >= lo && k < hi; k += step {
+			c, ok := lineColor(img, line(k))
+			if !ok || colorDistance(c, edge) > borderTolerance {
+				break
+			}
+		}
+		return k
+	}
+	symmetric := func(a, b, total int) bool {
+		return math.Abs(float64(a-b)) <= math.Max(2, float64(total)/50)
+	}
+	row := func(y int) image.Rectangle { return image.Rect(r.Min.X, y, r.Max.X, y+1) }
+	top := scan(b.Min.Y, b.Max.Y, 1, b.Min.Y, b.Max.Y, row)
+	if top == b.Max.Y {
+		return b // picture of one color
+	}
+	bottom := scan(b.Max.Y-1, top, -1, b.Min.Y, b.Max.Y, row) + 1
+	if symmetric(top-b.Min.Y, b.Max.Y-bottom, b.Dy()) {
+		r.Min.Y, r.Max.Y = top, bottom
+	}
+	col := func(x int) image.Rectangle { return image.Rect(x, r.Min.Y, x+1, r.Max.Y) }
+	left := scan(b.Min.X, b.Max.X, 1, b.Min.X, b.Max.X, col)
+	if left >= b.Max.X {
+		return r // columns of one color, content has no pillarbox
+	}
+	right := scan(b.Max.X-1, left, -1, b.Min.X, b.Max.X, col) + 1
+	if left < right && symmetric(left-b.Min.X, b.Max.X-right, b.Dx()) {
+		r.Min.X, r.Max.X = left, right
+	}
+	return r
+}
+
+// squareRect(image.Rectangle) image.Rectangle
+// center square of rectangle
+func squareRect(r image.Rectangle) image.Rectangle {
+	side := min(r.Dx(), r.Dy())
+	x := r.Min.X + (r.Dx()-side)/2
+	y := r.Min.Y + (r.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// resizeImage(image.Image, image.Rectangle, int, int) *image.RGBA
+// part of picture scaled to width and height, every pixel is mean of its source area
+func resizeImage(img image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	ret := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0 := r.Min.Y + dy*r.Dy()/h
+		y1 := max(r.Min.Y+(dy+1)*r.Dy()/h, y0+1)
+		for dx := 0; dx < w; dx++ {
+			x0 := r.Min.X + dx*r.Dx()/w
+			x1 := max(r.Min.X+(dx+1)*r.Dx()/w, x0+1)
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+					sum[0] += int(c.R)
+					sum[1] += int(c.G)
+					sum[2] += int(c.B)
+					sum[3] += int(c.A)
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			ret.SetRGBA(dx, dy, color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), uint8((sum[3] + n/2) / n)})
+		}
+	}
+	return ret
+}
+
+// processCover(image.Image, CoverSettings) *image.RGBA
+// remove bars, crop square and scale by settings
+func processCover(img image.Image, c CoverSettings) *image.RGBA {
+	r := contentRect(img)
+	if c.Square {
+		r = squareRect(r)
+	}
+	w, h := r.Dx(), r.Dy()
+	if c.Size > 0 {
+		if w >= h {
+			w, h = c.Size, max(1, h*c.Size/w)
+		} else {
+			w, h = max(1, w*c.Size/h), c.Size
+		}
+	}
+	return resizeImage(img, r, w, h)
+}
+
+// placeholderColors - backgrounds of generated covers
+var placeholderColors = []color.RGBA{
+	{34, 139, 87, 0xff},
+	{52, 73, 124, 0xff},
+	{122, 48, 108, 0xff},
+	{156, 82, 36, 0xff},
+	{40, 110, 130, 0xff},
+	{90, 90, 90, 0xff},
+}
+
+// placeholderCover(string, int) *image.RGBA
+// cover for video without picture: circle and title on color of title
+func placeholderCover(title string, size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	bg := placeholderColors[h.Sum32()%uint32(len(placeholderColors))]
+	circle := color.RGBA{255, 99, 71, 0xff}
+	c, rr := float64(size)/2, float64(size)*0.4
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			xx, yy := float64(x)-c+0.5, float64(y)-c+0.5
+			if xx*xx+yy*yy < rr*rr {
+				img.SetRGBA(x, y, circle)
+			} else {
+				img.SetRGBA(x, y, bg)
+			}
+		}
+	}
+	lines := wrapTitle(glyphText(title), placeholderChars, placeholderLines)
+	scale := max(1, size/(placeholderChars*6+12))
+	top := (size - len(lines)*9*scale) / 2
+	for k, line := range lines {
+		left := (size - len([]rune(line))*6*scale) / 2
+		for i, r := range line {
+			drawGlyph(img, r, left+i*6*scale, top+k*9*scale, scale, color.RGBA{255, 255, 255, 0xff})
+		}
+	}
+	return img
+}
+
+// glyphText(string) string
+// title in letters of bitmap font: upper case, cyrillic is transliterated, unknown symbols are dropped
+func glyphText(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(title) {
+		switch {
+		case glyphs[r] != [7]uint8{} || r == ' ':
+			b.WriteRune(r)
+		case cyrillicLatin[unicode.ToLower(r)] != "":
+			b.WriteString(strings.ToUpper(cyrillicLatin[unicode.ToLower(r)]))
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// wrapTitle(string, int, int) []string
+// words by lines not longer than width, long words are cut, last line ends by dots if text is longer
+func wrapTitle(text string, width, lines int) []string {
+	var ret []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				ret = append(ret, line)
+				line = ""
+			}
+			ret = append(ret, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			ret = append(ret, line)
+			line = word
+		}
+	}
+	if line != "" {
+		ret = append(ret, line)
+	}
+	if len(ret) > lines {
+		ret = ret[:lines]
+		last := []rune(ret[lines-1])
+		if len(last) > width-2 {
+			last = last[:width-2]
+		}
+		ret[lines-1] = string(last) + ".."
+	}
+	return ret
+}
+
+// drawGlyph(*image.RGBA, rune, int, int, int, color.RGBA)
+// letter of 5x7 bitmap font, every point is square of scale
+func drawGlyph(img *image.RGBA, r rune, x, y, scale int, c color.RGBA) {
+	g := glyphs[r]
+	for row := 0; row < 7; row++ {
+		for col := 0; col < 5; col++ {
+			if g[row]&(0x10>>col) == 0 {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetRGBA(x+col*scale+dx, y+row*scale+dy, c)
+				}
+			}
+		}
+	}
+}
+
+// glyphs - 5x7 bitmap font, bits of rows from left
+var glyphs = map[rune][7]uint8{
+	'A':  {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B':  {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C':  {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D':  {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G':  {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H':  {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I':  {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M':  {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P':  {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q':  {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R':  {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S':  {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T':  {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X':  {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0':  {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1':  {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3':  {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4':  {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5':  {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6':  {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9':  {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'-':  {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'?':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'\'': {0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'&':  {0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'[':  {0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E},
+	']':  {0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E},
+	':':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+}
+
+// cyrillicLatin - transliteration of cyrillic titles for bitmap font
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i", 'й': "y",
+	'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch", 'ы': "y", 'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye",
+}
+
+// fetchCover(string) (image.Image, error)
+// download and decode thumbnail
+func fetchCover(url string) (image.Image, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(sprintf("%d - error downloading %s", resp.StatusCode, url))
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, coverMaxBytes))
+	return img, err
+}
+
+// DownloadCover(*Tasker, Thing, *Message)
+// first thumbnail which is loaded from chain of sizes is processed by user settings, placeholder if all are failed
+func DownloadCover(T *Tasker, task Thing, message *Message) {
+	defer new(Timer).Start().Stop()
+	v := task.Input.(*JsonPls)
+	usr := GetCtx[*botUser](T, userParam, message)
+	settings := usr.coverSettings()
+	var img image.Image
+	for _, url := range v.Pictures {
+		select {
+		case <-T.Branch.Context.Done():
+			return
+		default:
+		}
+		var err error
+		if img, err = fetchCover(url); err == nil {
+			break
+		}
+		v.toLog("cover: "+err.Error(), true)
+	}
+	var cover *image.RGBA
+	if img != nil {
+		cover = processCover(img, settings)
+	} else {
+		v.toLog("cover: placeholder", true)
+		size := settings.Size
+		if size == 0 {
+			size = placeholderSize
+		}
+		cover = placeholderCover(v.Artist+" - "+v.Song, size)
+	}
+	err := saveJpeg(v.URLSaved+jpg, cover, settings.Quality)
+	if err != nil {
+		v.toLog(err.Error(), true)
+	}
+	message.AddCtx(T, v.URLSaved+jpg, err == nil)
+	if !debug {
+		sendFiles(T, task, jpg, message)
+	}
+}
+
+// saveJpeg(string, image.Image, int) error
+// write picture as JPEG
+func saveJpeg(path string, img image.Image, quality int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: quality}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// addCoverCommands(*Commands, *Tasker)
+// command 'cover' shows and changes cover settings
+func (obj *Action) addCoverCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandCover, "🖼cover", false, false, func(message Message, usr *botUser) {
+		arg := strings.ToLower(commandArgument(message, commandCover))
+		message.DelBefore = true
+		settings, err := parseCoverSettings(arg)
+		switch {
+		case arg == "":
+			message.Text = message.tr("Cover") + ": <code>" + usr.coverSettings().String() + "</code>\n\n" + coverHelp
+		case arg == "reset":
+			usr.setParameter(paramParam, paramCover, "")
+			message.Text = message.tr("Cover") + ": <code>" + usr.coverSettings().String() + "</code>"
+		case err != nil:
+			message.Text = infoLabel + html.EscapeString(err.Error()) + "\n\n" + coverHelp
+		default:
+			usr.setParameter(paramParam, paramCover, settings.String())
+			message.Text = message.tr("Cover") + ": <code>" + settings.String() + "</code>"
+		}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files of tests")
+
+// syntheticCover(int, int, image.Rectangle, color.RGBA) *image.RGBA
+// gradient picture inside of rectangle, bars of color with JPEG-like noise around it
+func syntheticCover(w, h int, content image.Rectangle, bar color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if image.Pt(x, y).In(content) {
+				img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x ^ y) & 0xff), 0xff})
+				continue
+			}
+			noise := uint8((x*7 + y*13) % 9)
+			img.SetRGBA(x, y, color.RGBA{bar.R + noise, bar.G + noise, bar.B + noise, 0xff})
+		}
+	}
+	return img
+}
+
+// checkGolden(*testing.T, string, *image.RGBA)
+// compare picture with testdata/cover/name.png, -update rewrites file
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", "cover", name+".png")
+	if *updateGolden {
+		var b bytes.Buffer
+		if err := png.Encode(&b, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("%s: size %v, golden %v", name, img.Bounds(), golden.Bounds())
+	}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if color.RGBAModel.Convert(golden.At(x, y)) != img.At(x, y) {
+				t.Fatalf("%s: pixel %d,%d = %v, golden %v", name, x, y, img.At(x, y), golden.At(x, y))
+			}
+		}
+	}
+}
+
+func Test_contentRect(t *testing.T) {
+	// white bars around content of one dark color: columns are uniform after rows are cropped
+	solidContent := image.NewRGBA(image.Rect(0, 0, 120, 90))
+	for y := 0; y < 90; y++ {
+		c := color.RGBA{5, 5, 5, 0xff}
+		if y < 15 || y >= 75 {
+			c = color.RGBA{250, 250, 250, 0xff}
+		}
+		for x := 0; x < 120; x++ {
+			solidContent.SetRGBA(x, y, c)
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		img     *image.RGBA
+		content image.Rectangle
+	}{
+		{"letterbox", syntheticCover(480, 360, image.Rect(0, 45, 480, 315), color.RGBA{0, 0, 0, 0xff}), image.Rect(0, 45, 480, 315)},
+		{"pillarbox", syntheticCover(640, 360, image.Rect(80, 0, 560, 360), color.RGBA{30, 30, 30, 0xff}), image.Rect(80, 0, 560, 360)},
+		{"both", syntheticCover(480, 360, image.Rect(60, 45, 420, 315), color.RGBA{0, 0, 0, 0xff}), image.Rect(60, 45, 420, 315)},
+		{"asymmetric", syntheticCover(480, 360, image.Rect(0, 90, 480, 360), color.RGBA{0, 0, 0, 0xff}), image.Rect(0, 0, 480, 360)},
+		{"full", syntheticCover(320, 180, image.Rect(0, 0, 320, 180), color.RGBA{}), image.Rect(0, 0, 320, 180)},
+		{"solid", syntheticCover(120, 90, image.Rectangle{}, color.RGBA{200, 10, 10, 0xff}), image.Rect(0, 0, 120, 90)},
+		{"solid content", solidContent, image.Rect(0, 15, 120, 75)},
+	} {
+		if got := contentRect(tt.img); got != tt.content {
+			t.Errorf("contentRect(%s) = %v, want %v", tt.name, got, tt.content)
+		}
+	}
+}
+
+func Test_processCoverGolden(t *testing.T) {
+	letterbox := syntheticCover(480, 360, image.Rect(0, 45, 480, 315), color.RGBA{0, 0, 0, 0xff})
+	pillarbox := syntheticCover(640, 360, image.Rect(80, 0, 560, 360), color.RGBA{30, 30, 30, 0xff})
+	for _, tt := range []struct {
+		name     string
+		img      image.Image
+		settings string
+		w, h     int
+	}{
+		{"letterbox_full_240", letterbox, "240", 240, 135},
+		{"letterbox_square_128", letterbox, "square 128", 128, 128},
+		{"pillarbox_square_96", pillarbox, "square 96", 96, 96},
+	} {
+		c, err := parseCoverSettings(tt.settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := processCover(tt.img, c)
+		if got.Bounds().Dx() != tt.w || got.Bounds().Dy() != tt.h {
+			t.Errorf("processCover(%s) size = %v, want %dx%d", tt.name, got.Bounds(), tt.w, tt.h)
+			continue
+		}
+		checkGolden(t, tt.name, got)
+	}
+	checkGolden(t, "placeholder", placeholderCover("Artist - Very Long Song Title (Live) Тест", 200))
+}
+
+func Test_coverHelpers(t *testing.T) {
+	thumbs := Thumbnails{High: Thumbnail{URL: "hq"}, Default: Thumbnail{URL: "d"}, Maxres: Thumbnail{URL: "max"}}
+	if got := thumbs.urls(); len(got) != 3 || got[0] != "max" || got[1] != "hq" || got[2] != "d" {
+		t.Errorf("urls() = %v", got)
+	}
+	for _, tt := range []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"", "full 0 q90", false},
+		{"square 600 q85", "square 600 q85", false},
+		{"Q70 800px full", "full 800 q70", false},
+		{"q20", "", true},
+		{"32", "", true},
+		{"round", "", true},
+	} {
+		c, err := parseCoverSettings(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCoverSettings(%q) error = %v", tt.text, err)
+			continue
+		}
+		if !tt.wantErr && c.String() != tt.want {
+			t.Errorf("parseCoverSettings(%q) = %q, want %q", tt.text, c.String(), tt.want)
+		}
+	}
+	if got := glyphText("Мой трек #1 — ok"); got != "MOY TREK 1 OK" {
+		t.Errorf("glyphText() = %q", got)
+	}
+	if got := wrapTitle("ARTIST - VERY LONG SONG TITLE", 10, 2); len(got) != 2 || got[0] != "ARTIST -" || got[1] != "VERY LON.." {
+		t.Errorf("wrapTitle() = %q", got)
+	}
+}
@@ -37,6 +37,8 @@ type Action struct {
 	Cid        int
 	Sleep      time.Duration
 	Q          *Query
+	Jobs       *JobList
+	Previews   *PreviewList
 }
 
 type DataBase struct {
@@ -90,6 +92,37 @@ func (o *botUser) getUserInfo() {
 	o.Parameters = make(map[string]string)
 }
 
+// touch(string)
+// remember user name and time of last activity
+func (o *botUser) touch(name string) {
+	o.Db.Db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(o.Sid))
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte("last_activity"), []byte(time.Now().Format(time.RFC3339))); err != nil || name == "" {
+			return err
+		}
+		if b, err = tx.CreateBucketIfNotExists([]byte("users")); err != nil {
+			return err
+		}
+		return b.Put([]byte(o.Sid), []byte(name))
+	})
+}
+
+// lastActivity() time.Time
+// time of last user activity, zero if unknown
+func (o *botUser) lastActivity() time.Time {
+	t, _ := time.Parse(time.RFC3339, o.getDbVal("last_activity"))
+	return t
+}
+
+// isAdmin() bool
+// user is in admin list
+func (o *botUser) isAdmin() bool {
+	return admins[o.Id]
+}
+
 // pUM(string)
 // get json value from database by key
 func (o *botUser) pUM(key string) {
@@ -129,7 +162,7 @@ func (o *botUser) turnParameter(basket, key string) {
 // Open(string)
 // new database with timeout checkout
 func (o *DataBase) Open(name string) {
-	o.Db, _ = bolt.Open(name+".db", 0600, &bolt.Options{Timeout: 1 * time.Second})
+	o.Db, o.Err = bolt.Open(name+".db", 0600, &bolt.Options{Timeout: 1 * time.Second})
 }
 
 // Close()
@@ -166,6 +199,19 @@ func (o *DataBase) Delete(name string) {
 	})
 }
 
+// Buckets() []string
+// names of all backets in database
+func (o *DataBase) Buckets() []string {
+	var names []string
+	o.Db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, string(name))
+			return nil
+		})
+	})
+	return names
+}
+
 // Add(string, string)
 // add uniq value in backet
 func (o *DataBaseBucket) Add(key, value string) {
@@ -201,6 +247,36 @@ func (o *DataBaseBucket) Put(key, value string) {
 	})
 }
 
+// Del(string)
+// delete value from backet
+func (o *DataBaseBucket) Del(key string) {
+	o.Parent.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(o.Name))
+		if b != nil {
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+// Take(string) string
+// get value from backet by full key and delete it in one transaction
+func (o *DataBaseBucket) Take(key string) string {
+	value := ""
+	o.Parent.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(o.Name))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			value = string(v)
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+	return value
+}
+
 // PrintAll() map[string]string
 // get all values from backet. Debug
 func (o *DataBaseBucket) PrintAll() map[string]string {
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+const dbToolUsage = `usage: tv_mess db [-path database] <command> [args]
+
+commands:
+  dump [file]     write all buckets as JSON to file (stdout if omitted)
+  restore <file>  load buckets from JSON dump, replacing buckets with same name
+  users           list users and their settings
+  deluser <id>    delete user bucket by chat ID
+  compact         rewrite database file without free pages
+
+Stop the bot before using these commands, database file is locked while it runs.
+`
+
+// DataBaseDump - all buckets of database, bucket name -> key -> value
+type DataBaseDump map[string]map[string]string
+
+// databaseDefaultPath() string
+// path to database near executable (without extension)
+func databaseDefaultPath() string {
+	path, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	if err != nil {
+		toLog(err)
+	}
+	return filepath.Join(path, databasename)
+}
+
+// dbTool([]string) int
+// entry point for 'tv_mess db ...' subcommands. Return exit code
+func dbTool(args []string) int {
+	fs := flag.NewFlagSet("db", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	path := fs.String("path", databaseDefaultPath(), "database file without '.db' extension")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, dbToolUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	db := new(DataBase)
+	db.Open(*path)
+	if db.Err != nil {
+		fmt.Fprintf(os.Stderr, "open %s.db: %v (is the bot still running?)\n", *path, db.Err)
+		return 1
+	}
+	defer func() {
+		if db.Db != nil {
+			db.Close()
+		}
+	}()
+	var err error
+	switch cmd, rest := fs.Arg(0), fs.Args()[1:]; cmd {
+	case "dump":
+		out := io.Writer(os.Stdout)
+		if len(rest) > 0 {
+			file, errCreate := os.Create(rest[0])
+			if errCreate != nil {
+				err = errCreate
+				break
+			}
+			defer file.Close()
+			out = file
+		}
+		err = db.Dump().Write(out)
+	case "restore":
+		if len(rest) == 0 {
+			err = errors.New("restore: dump file required")
+			break
+		}
+		var dump DataBaseDump
+		dump, err = readDataBaseDump(rest[0])
+		if err == nil {
+			err = db.Restore(dump)
+		}
+	case "users":
+		db.printUsers(os.Stdout)
+	case "deluser":
+		if len(rest) == 0 {
+			err = errors.New("deluser: chat ID required")
+			break
+		}
+		err = db.DeleteUser(rest[0])
+	case "compact":
+		err = db.Compact(*path)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Dump() DataBaseDump
+// get all buckets with values
+func (o *DataBase) Dump() DataBaseDump {
+	dump := make(DataBaseDump)
+	for _, name := range o.Buckets() {
+		dump[name] = (&DataBaseBucket{Name: name, Parent: o.Db}).PrintAll()
+	}
+	return dump
+}
+
+// Write(io.Writer) error
+// encode dump as indented JSON
+func (o DataBaseDump) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(o)
+}
+
+// readDataBaseDump(string) (DataBaseDump, error)
+// read JSON dump from file
+func readDataBaseDump(name string) (DataBaseDump, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var dump DataBaseDump
+	if err = json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return dump, nil
+}
+
+// Restore(DataBaseDump) error
+// replace buckets from dump in one transaction. Buckets missing in dump stay untouched
+func (o *DataBase) Restore(dump DataBaseDump) error {
+	return o.Db.Update(func(tx *bolt.Tx) error {
+		for name, values := range dump {
+			if tx.Bucket([]byte(name)) != nil {
+				if err := tx.DeleteBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return fmt.Errorf("bucket %q: %w", name, err)
+			}
+			for k, v := range values {
+				if err = b.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// userIDs() []int64
+// chat IDs of users (buckets with numeric names)
+func (o *DataBase) userIDs() []int64 {
+	var ids []int64
+	for _, name := range o.Buckets() {
+		if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// printUsers(io.Writer)
+// list of users and their settings
+func (o *DataBase) printUsers(w io.Writer) {
+	for _, id := range o.userIDs() {
+		usr := new(botUser)
+		usr.Db = o
+		usr.Id = id
+		usr.Sid = sprintf("%d", id)
+		usr.pUM(paramParam)
+		keys := make([]string, 0, len(usr.Parameters))
+		for k := range usr.Parameters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "%d\n", id)
+		for _, k := range keys {
+			fmt.Fprintf(w, "    %s = %s\n", k, usr.Parameters[k])
+		}
+	}
+}
+
+// DeleteUser(string) error
+// delete user bucket and user record
+func (o *DataBase) DeleteUser(sid string) error {
+	if _, err := strconv.ParseInt(sid, 10, 64); err != nil {
+		return fmt.Errorf("deluser: %q is not chat ID", sid)
+	}
+	return o.Db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(sid)); err != nil {
+			return fmt.Errorf("deluser %s: %w", sid, err)
+		}
+		if b := tx.Bucket([]byte("users")); b != nil {
+			return b.Delete([]byte(sid))
+		}
+		return nil
+	})
+}
+
+// Compact(string) error
+// copy all buckets into new file and replace current database with it
+func (o *DataBase) Compact(name string) error {
+	tmp := new(DataBase)
+	os.Remove(name + ".compact.db")
+	tmp.Open(name + ".compact")
+	if tmp.Err != nil {
+		return tmp.Err
+	}
+	err := tmp.Restore(o.Dump())
+	tmp.Close()
+	if err != nil {
+		os.Remove(name + ".compact.db")
+		return err
+	}
+	before := fileSize(name + ".db")
+	o.Close()
+	o.Db = nil
+	if err = os.Rename(name+".compact.db", name+".db"); err != nil {
+		return err
+	}
+	fmt.Printf("compacted %s.db: %d -> %d bytes\n", name, before, fileSize(name+".db"))
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_dbtool_dump_restore(t *testing.T) {
+	dir := t.TempDir()
+	src := new(DataBase)
+	src.Open(filepath.Join(dir, "src"))
+	if src.Err != nil {
+		t.Fatal(src.Err)
+	}
+	usr := new(botUser).New(src, 42)
+	usr.setParameter(paramParam, Subscribe, true)
+	src.FindCreate("last").Put("id", "7")
+	var buf bytes.Buffer
+	if err := src.Dump().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Compact(filepath.Join(dir, "src")); err != nil {
+		t.Fatal(err)
+	}
+	var dump DataBaseDump
+	if err := json.Unmarshal(buf.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	dst := new(DataBase)
+	dst.Open(filepath.Join(dir, "src"))
+	if dst.Err != nil {
+		t.Fatal(dst.Err)
+	}
+	defer dst.Close()
+	dst.FindCreate("last").Put("stale", "1")
+	if err := dst.Restore(dump); err != nil {
+		t.Fatal(err)
+	}
+	if v := dst.FindCreate("last").Print("stale"); v != "" {
+		t.Errorf("restore kept stale key: %q", v)
+	}
+	if v := dst.FindCreate("last").Print("id"); v != "7" {
+		t.Errorf("last id = %q, want 7", v)
+	}
+	if ids := dst.userIDs(); len(ids) != 1 || ids[0] != 42 {
+		t.Errorf("users = %v, want [42]", ids)
+	}
+	if !sBool(new(botUser).New(dst, 42).getParameter(paramParam, Subscribe)) {
+		t.Error("user subscription lost")
+	}
+	if err := dst.DeleteUser("42"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := dst.userIDs(); len(ids) != 0 {
+		t.Errorf("users after delete = %v", ids)
+	}
+}
+
+func Test_DataBaseBucket_Take(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "take"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	invites := db.FindCreate("invites")
+	invites.Put("code", "1")
+	var wg sync.WaitGroup
+	var taken atomic.Int32
+	for k := 0; k < 20; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if invites.Take("code") != "" {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if taken.Load() != 1 || invites.Print("code") != "" {
+		t.Errorf("code is taken %d times", taken.Load())
+	}
+}
+
+func Test_botUser_touch(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "touch"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	usr := new(botUser).New(db, 5)
+	usr.touch("")
+	if usr.lastActivity().IsZero() || db.FindCreate("users").Print(usr.Sid) != "" {
+		t.Errorf("touch without name: activity %v, name %q", usr.lastActivity(), db.FindCreate("users").Print(usr.Sid))
+	}
+	usr.touch("someone")
+	if got := db.FindCreate("users").Print(usr.Sid); got != "someone" {
+		t.Errorf("name = %q", got)
+	}
+}
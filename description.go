@@ -0,0 +1,116 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MusicRelease - track information from description of auto-generated YouTube Music upload
+type MusicRelease struct {
+	Distributor string
+	Title       string
+	Artists     []string
+	Album       string
+	Label       string
+	Released    string // YYYY-MM-DD
+	Year        string
+	Composers   []string
+}
+
+var (
+	reProvided  = regexp.MustCompile(`^Provided to YouTube by (.+)$`)
+	reCopyright = regexp.MustCompile(`^[℗©]\s*(\d{4})?\s*(.*)$`)
+	reReleased  = regexp.MustCompile(`^Released on:\s*(\d{4})-(\d{2})-(\d{2})`)
+	reCredit    = regexp.MustCompile(`^([^:]{2,40}):\s*(.+)$`)
+)
+
+// parseProvidedDescription(string) (MusicRelease, bool)
+// parse "Provided to YouTube by" description. False if description has other format
+//
+//	Provided to YouTube by <distributor>
+//
+//	<title> · <artist> · <artist>
+//
+//	<album>
+//
+//	℗ <year> <label>
+//
+//	Released on: <YYYY-MM-DD>
+//
+//	Composer: <name>
+//	...
+//
+//	Auto-generated by YouTube.
+func parseProvidedDescription(desc string) (MusicRelease, bool) {
+	var ret MusicRelease
+	var blocks [][]string
+	var block []string
+	for _, line := range strings.Split(strings.ReplaceAll(desc, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) < 2 {
+		return ret, false
+	}
+	m := reProvided.FindStringSubmatch(blocks[0][0])
+	if m == nil {
+		return ret, false
+	}
+	ret.Distributor = strings.TrimSpace(m[1])
+	parts := strings.Split(blocks[1][0], " · ")
+	ret.Title = strings.TrimSpace(parts[0])
+	for _, v := range parts[1:] {
+		if v = strings.TrimSpace(v); v != "" {
+			ret.Artists = append(ret.Artists, v)
+		}
+	}
+	rest := blocks[2:]
+	// album is the block after title, its name may look like credit ("Live: 1999")
+	if len(rest) > 0 {
+		line := rest[0][0]
+		if !reCopyright.MatchString(line) && !reReleased.MatchString(line) && !strings.HasPrefix(line, "Auto-generated by YouTube") {
+			ret.Album = line
+			rest[0] = rest[0][1:]
+		}
+	}
+	for _, b := range rest {
+		for _, line := range b {
+			switch {
+			case reCopyright.MatchString(line):
+				m := reCopyright.FindStringSubmatch(line)
+				if ret.Year == "" {
+					ret.Year = m[1]
+				}
+				if ret.Label == "" {
+					ret.Label = strings.TrimSpace(m[2])
+				}
+			case reReleased.MatchString(line):
+				m := reReleased.FindStringSubmatch(line)
+				ret.Released = m[1] + "-" + m[2] + "-" + m[3]
+				ret.Year = m[1]
+			case strings.HasPrefix(line, "Auto-generated by YouTube"):
+			case reCredit.MatchString(line):
+				m := reCredit.FindStringSubmatch(line)
+				if strings.Contains(strings.ToLower(m[1]), "composer") {
+					for _, name := range strings.Split(m[2], ",") {
+						if name = strings.TrimSpace(name); name != "" && !slices.Contains(ret.Composers, name) {
+							ret.Composers = append(ret.Composers, name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return ret, ret.Title != ""
+}
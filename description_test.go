@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseProvidedDescription(t *testing.T) {
+	desc := "Provided to YouTube by The Orchard Enterprises\n\n" +
+		"Coral · LiQWYD · Second Artist\n\n" +
+		"Coral\n\n" +
+		"℗ 2019 LiQWYD Records\n\n" +
+		"Released on: 2019-05-10\n\n" +
+		"Composer: John Doe\nLyricist: Jane Doe\nComposer, Lyricist: John Doe, Jack Roe\n\n" +
+		"Auto-generated by YouTube."
+	want := MusicRelease{
+		Distributor: "The Orchard Enterprises",
+		Title:       "Coral",
+		Artists:     []string{"LiQWYD", "Second Artist"},
+		Album:       "Coral",
+		Label:       "LiQWYD Records",
+		Released:    "2019-05-10",
+		Year:        "2019",
+		Composers:   []string{"John Doe", "Jack Roe"},
+	}
+	got, ok := parseProvidedDescription(desc)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProvidedDescription() = %+v, %v\nwant %+v", got, ok, want)
+	}
+	got, ok = parseProvidedDescription("Provided to YouTube by Label\r\n\r\nSong · Artist\r\n\r\nAlbum\r\n\r\n℗ 2001 Label\r\n")
+	if !ok || got.Album != "Album" || got.Year != "2001" || got.Released != "" {
+		t.Errorf("short description = %+v, %v", got, ok)
+	}
+	got, ok = parseProvidedDescription("Provided to YouTube by Label\n\nIntro · Band\n\nLive: 1999\n\nProducer: Someone\n")
+	if !ok || got.Album != "Live: 1999" {
+		t.Errorf("album with colon = %+v, %v", got, ok)
+	}
+	if _, ok := parseProvidedDescription("Official video of the song.\n\nFollow us: https://example.com"); ok {
+		t.Error("usual description parsed as music release")
+	}
+}
@@ -5,9 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"image"
-	"image/color"
-	"image/jpeg"
+	"html"
 	"io"
 	"io/ioutil"
 	"net"
@@ -15,8 +13,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -56,10 +52,13 @@ type scrFile struct {
 
 // JsonPls - element of Resulting struct in Query
 type JsonPlsMinimal struct {
-	Num    int
-	ID     string
-	Artist string
-	Song   string
+	Num      int
+	Position int
+	ID       string
+	Artist   string
+	Song     string
+	Reason   string `json:",omitempty"`
+	Loudness string `json:",omitempty"` // measured loudness and applied gain
 }
 
 type JsonPls struct {
@@ -68,28 +67,64 @@ type JsonPls struct {
 	URL         string
 	URLDl       string
 	URLSaved    string
-	PicturePath string
+	Pictures    []string // cover candidates, biggest first
 	M           sync.RWMutex
 	UUID        string
 	Status      string
+	Size        int64
+	Album       string
+	AlbumArtist string
+	Year        string
+	Date        string
+	Label       string
+	Composer    string
+	Genre       string
+	Track       int
+	TrackTotal  int
+	Published   time.Time
+	Duration    time.Duration
+	Ordered     bool
+	Ready       chan struct{}
+	Chapters    []Chapter
+	Parts       []*JsonPls // chapters cut from audio
+	Clip        *ClipRange
+	Loudnorm    *Loudness // loudness of source in normalize mode, audio is normalized in conversion
+	URLDlAudio  string    // audio stream of adaptive video
+	Container   string    // extension of merged adaptive video
+	ClipVideo   bool      // clip is re-encoded video
+	Hold        QuotaHold // reserved quota, refunded if element fails
+	readyOnce   sync.Once
 }
 
 // Query does work as central content which handle all program
 type Query struct {
-	KeyApi       string
-	Playlists    []string
-	Host         string
-	Type         string
-	Parameters   map[string]string
-	Data         any
-	Result       []*JsonPls
-	Tasker       *Tasker
-	Error        error
-	Np           string
-	M            *sync.RWMutex
-	videoQ       string
-	playlistQ    string
-	JsonFilename string
+	KeyApi        string
+	Playlists     []string
+	Host          string
+	Type          string
+	Parameters    map[string]string
+	Data          any
+	Result        []*JsonPls
+	Skipped       []*JsonPls
+	QuotaNotice   bool
+	Tasker        *Tasker
+	Error         error
+	Np            string
+	M             *sync.RWMutex
+	videoQ        string
+	playlistQ     string
+	playlistInfoQ string
+	Albums        map[string]AlbumInfo
+	AlbumMode     bool
+	Ordered       bool
+	SortBy        string
+	SortReverse   bool
+	Hold          bool                               // download starts after Confirm
+	Confirm       func(*Tasker, *Message) []*JsonPls // chosen elements, nil - cancel
+	Filter        *PlaylistFilter                    // selectors after playlist link, nil - all
+	Clip          *ClipRange                         // part of single video, nil - whole video
+	Itag          int                                // format chosen in picker, 0 - by user quality
+	JsonFilename  string
 }
 
 // Query() []byte
@@ -138,9 +173,9 @@ func (o *Query) Query() []byte {
 // sort resulting information of playlist elements to file
 func (o *Query) SortWrapperTask(T *Tasker, task Thing, message *Message) {
 	toLog("SORTING")
-	sort.Slice(o.Result, func(i, j int) bool {
-		return o.Result[i].Artist+o.Result[i].Song < o.Result[j].Artist+o.Result[j].Song
-	})
+	o.M.Lock()
+	defer o.M.Unlock()
+	sortTracks(o.Result, o.SortBy, o.SortReverse)
 	for k, v := range o.Result {
 		v.Num = k + 1
 	}
@@ -169,6 +204,11 @@ func (o *Query) SaveWrapperTask(T *Tasker, task Thing, message *Message) {
 	for _, tmpv := range o.Result {
 		tmp = append(tmp, &tmpv.JsonPlsMinimal)
 	}
+	o.M.RLock()
+	for _, tmpv := range o.Skipped {
+		tmp = append(tmp, &tmpv.JsonPlsMinimal)
+	}
+	o.M.RUnlock()
 	err := enc.Encode(&tmp)
 	if err != nil {
 		toLog(sprintf("!!! %s\n", err.Error()))
@@ -192,9 +232,127 @@ func (o *Query) Exist(val *JsonPls) bool {
 	return false
 }
 
+// handled() int
+// count of processed playlist elements (added and skipped)
+func (o *Query) handled() int {
+	o.M.RLock()
+	defer o.M.RUnlock()
+	return len(o.Result) + len(o.Skipped)
+}
+
+// Skip(*JsonPls, string)
+// element will not be downloaded
+func (o *Query) Skip(v *JsonPls, reason string) {
+	o.M.Lock()
+	v.Reason = reason
+	o.Skipped = append(o.Skipped, v)
+	o.M.Unlock()
+	v.toLog(reason, true)
+}
+
+// quotaReached() bool
+// user quota exceeded during this query
+func (o *Query) quotaReached() bool {
+	o.M.RLock()
+	defer o.M.RUnlock()
+	return o.QuotaNotice
+}
+
+// quotaExceeded(*Tasker, string, *Message)
+// inform user once per query, rest of elements will be skipped
+func (o *Query) quotaExceeded(T *Tasker, reason string, message *Message) {
+	o.M.Lock()
+	first := !o.QuotaNotice
+	o.QuotaNotice = true
+	o.M.Unlock()
+	if first {
+		m := *message
+		m.ReplyMarkup = Buttons{}
+		m.DelAfter = false
+		m.Text = infoLabel + m.tr("Quota exceeded ("+reason+"). Remaining tracks are skipped.") + " /quota"
+		m.extensionMessaging(T, sendParam, false, m.sendMessage)
+	}
+}
+
+// reserve(*Tasker, *JsonPls, *botUser, *Message) bool
+// reserve user quota for element, skip it if exceeded
+func (o *Query) reserve(T *Tasker, v *JsonPls, usr *botUser, message *Message) bool {
+	q := Quota{Tracks: 1}
+	if sBool(usr.getParameter(paramParam, mp3)) {
+		q.Minutes = quotaMinutes(v.Duration)
+	}
+	if reason := v.Hold.reserve(usr, q); reason != "" {
+		o.Skip(v, "quota: "+reason)
+		o.quotaExceeded(T, reason, message)
+		v.done()
+		return false
+	}
+	return true
+}
+
+// refundFailed(*botUser)
+// give back quota of elements which were not done (failed or canceled)
+func (o *Query) refundFailed(usr *botUser) {
+	o.M.RLock()
+	list := append(append([]*JsonPls(nil), o.Result...), o.Skipped...)
+	o.M.RUnlock()
+	for _, v := range list {
+		v.Hold.refund(usr)
+	}
+}
+
+// startSelected(*Tasker, []*JsonPls, *Message) bool
+// download chosen elements of held query, other elements are skipped
+func (o *Query) startSelected(T *Tasker, selected []*JsonPls, message *Message) bool {
+	if selected == nil {
+		return false
+	}
+	usr := GetCtx[*botUser](T, userParam, message)
+	chosen := make(map[*JsonPls]bool)
+	for _, v := range selected {
+		chosen[v] = true
+	}
+	o.M.Lock()
+	all := o.Result
+	o.Result = nil
+	o.M.Unlock()
+	for _, v := range all {
+		if !chosen[v] {
+			o.Skip(v, "not selected")
+			continue
+		}
+		if !o.reserve(T, v, usr, message) {
+			continue
+		}
+		o.M.Lock()
+		o.Result = append(o.Result, v)
+		o.M.Unlock()
+		T.Add(v, o.DownloadWrapperTask, message)
+	}
+	return true
+}
+
+// quotaPreview(*Tasker, int, *Message)
+// warn before download if playlist is bigger than tracks quota
+func (o *Query) quotaPreview(T *Tasker, total int, message *Message) {
+	left := GetCtx[*botUser](T, userParam, message).tracksLeft()
+	if left < 0 || int64(total) <= left {
+		return
+	}
+	m := *message
+	m.ReplyMarkup = Buttons{}
+	m.DelAfter = false
+	m.Text = infoLabel + m.tr("Playlist is bigger than your quota. Tracks in playlist") + sprintf(": %d, ", total) + m.tr("will be downloaded") + sprintf(": %d. /quota", left)
+	m.extensionMessaging(T, sendParam, false, m.sendMessage)
+}
+
 // GetInformationPlaylist(*Tasker, Thing, *Message)
 // get information through YT api v3. Playlist element
 func (o *Query) GetInformationPlaylist(T *Tasker, message *Message) {
+	usr := GetCtx[*botUser](T, userParam, message)
+	o.SortBy, o.SortReverse = usr.sortMode()
+	o.setAlbumMode(usr)
+	o.Ordered = true
 	for _, vpls := range o.Playlists {
 		toLog("GET PLAYLIST", "(", vpls, ")")
 		o.GetInformationFromPlaylist(T, vpls, "", message)
@@ -203,7 +361,7 @@ func (o *Query) GetInformationPlaylist(T *Tasker, message *Message) {
 	var notfound = make(chan struct{})
 	go func() {
 		for {
-			if GetCtx[int](T, readinfoParamComplete, message) == len(o.Result) || timeout {
+			if GetCtx[int](T, readinfoParamComplete, message) <= o.handled() || timeout {
 				notfound <- struct{}{}
 				close(notfound)
 				return
@@ -215,8 +373,21 @@ func (o *Query) GetInformationPlaylist(T *Tasker, message *Message) {
 		timeout = true
 	case <-notfound:
 	}
+	if o.Hold && o.Confirm != nil && !o.startSelected(T, o.Confirm(T, message), message) {
+		message.AddCtx(T, saveinfoParamComplete, true)
+		if !debug {
+			os.RemoveAll(message.UUID)
+		}
+		return
+	}
 	T.Add(nil, o.SortWrapperTask, message)
 	T.Add(nil, o.SaveWrapperTask, message)
+	// job is finished after sending, but workers are free for downloads
+	T.Wg.Add(1)
+	go func() {
+		defer T.Wg.Done()
+		o.sendOrdered(T, message)
+	}()
 }
 
 // GetInformationVideo(*Tasker, Thing, *Message)
@@ -238,7 +409,7 @@ func (o *Query) GetInformationVideo(T *Tasker, id string, message *Message) {
 	var notfound = make(chan struct{})
 	go func() {
 		for {
-			if len(o.Result) != 0 || timeout {
+			if o.handled() != 0 || timeout {
 				notfound <- struct{}{}
 				close(notfound)
 				return
@@ -250,6 +421,7 @@ func (o *Query) GetInformationVideo(T *Tasker, id string, message *Message) {
 		timeout = true
 	case <-notfound:
 	}
+	o.sendSkipped(T, message)
 	T.Add(nil, o.SortWrapperTask, message)
 	T.Add(nil, o.SaveWrapperTask, message)
 }
@@ -264,18 +436,73 @@ func (o *Query) GetInformationFromPlaylist(T *Tasker, vpls, next string, message
 	o.Data = &bytes.Reader{}
 	var ret PlaylistItem
 	json.Unmarshal(o.Query(), &ret)
-	message.AddCtx(T, readinfoParamComplete, ret.PageInfo.TotalResults)
+	total := ret.PageInfo.TotalResults
+	if last := o.Filter.lastPosition(); last > 0 && ret.NextPageToken != "" {
+		fetched := 0
+		for _, v := range ret.Items {
+			fetched = max(fetched, v.Snippet.Position+1)
+		}
+		// positions after the filter are not requested, wait only fetched ones
+		if fetched >= last {
+			ret.NextPageToken = ""
+			total = fetched
+		}
+	}
+	message.AddCtx(T, readinfoParamComplete, total)
+	if next == "" {
+		if !o.Hold {
+			o.quotaPreview(T, ret.PageInfo.TotalResults, message)
+		}
+		o.GetPlaylistTitle(vpls)
+	}
 	T.Add(&ret, o.GetWrapperTask, message)
 	if ret.NextPageToken != "" {
 		go o.GetInformationFromPlaylist(T, vpls, ret.NextPageToken, message)
 	}
 }
 
+// GetPlaylistTitle(string)
+// get playlist title, owner and cover through YT api v3, used as album
+func (o *Query) GetPlaylistTitle(vpls string) {
+	var vq Query
+	vq.Host = fmt.Sprintf(o.playlistInfoQ, vpls)
+	vq.Parameters = make(map[string]string)
+	vq.Type = http.MethodGet
+	var info PlaylistInformation
+	json.Unmarshal(vq.Query(), &info)
+	o.M.Lock()
+	defer o.M.Unlock()
+	if o.Albums == nil {
+		o.Albums = make(map[string]AlbumInfo)
+	}
+	for _, v := range info.Items {
+		album := AlbumInfo{Title: v.Snippet.Title, Artist: strings.TrimSuffix(v.Snippet.ChannelTitle, " - Topic")}
+		album.Covers = v.Snippet.Thumbnails.urls()
+		o.Albums[v.ID] = album
+	}
+}
+
+// album(string) AlbumInfo
+// playlist information by id
+func (o *Query) album(vpls string) AlbumInfo {
+	o.M.RLock()
+	defer o.M.RUnlock()
+	return o.Albums[vpls]
+}
+
 // GetWrapperTask(*Tasker, Thing, *Message)
 // get information through YT api v3
 func (o *Query) GetWrapperTask(T *Tasker, task Thing, message *Message) {
 	ret := task.Input.(*PlaylistItem)
 	for _, vv := range ret.Items {
+		if o.quotaReached() {
+			o.Skip(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: vv.ContentDetails.VideoID}}, "quota")
+			continue
+		}
+		if !o.Filter.matchPosition(vv.Snippet.Position+1, ret.PageInfo.TotalResults) {
+			o.Skip(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: vv.ContentDetails.VideoID}}, "filter: position")
+			continue
+		}
 		var vq Query
 		vq.Host = fmt.Sprintf(o.videoQ, vv.ContentDetails.VideoID)
 		vq.Parameters = make(map[string]string)
@@ -283,6 +510,13 @@ func (o *Query) GetWrapperTask(T *Tasker, task Thing, message *Message) {
 		list := vq.Query()
 		var vJson ItemInformation
 		json.Unmarshal(list, &vJson)
+		if len(vJson.Items) == 0 {
+			o.Skip(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: vv.ContentDetails.VideoID}}, "unavailable")
+			continue
+		}
+		vJson.PlaylistID = vv.Snippet.PlaylistID
+		vJson.Position = vv.Snippet.Position
+		vJson.PlaylistTotal = ret.PageInfo.TotalResults
 		T.Add(&vJson, o.GetVideoWrapperTask, message)
 	}
 }
@@ -291,36 +525,117 @@ func (o *Query) GetWrapperTask(T *Tasker, task Thing, message *Message) {
 // get information through YT api v3
 func (o *Query) GetVideoWrapperTask(T *Tasker, task Thing, message *Message) {
 	vJson := task.Input.(*ItemInformation)
+	usr := GetCtx[*botUser](T, userParam, message)
+	rules := usr.titleRules()
 	for _, vv := range vJson.Items {
 		next := new(JsonPls)
 		next.Num = 0
 		next.M = sync.RWMutex{}
 		next.ID = vv.ID
-		next.Artist = replaceSpecialSymbols(strings.Replace(vv.Snippet.ChannelTitle, " - Topic", "", -1))
-		next.Song = replaceSpecialSymbols(vv.Snippet.Title)
-		next.Title = next.Artist + "[" + next.Song + "]"
+		release, music := parseProvidedDescription(vv.Snippet.Description)
+		if !music {
+			artist, song := normalizeTrack(vv.Snippet.ChannelTitle, vv.Snippet.Title, rules)
+			next.Artist = artist
+			next.Song = song
+		} else {
+			next.Artist = strings.Replace(vv.Snippet.ChannelTitle, " - Topic", "", -1)
+			next.Song = release.Title
+			if len(release.Artists) > 0 {
+				next.Artist = strings.Join(release.Artists, ", ")
+				next.AlbumArtist = release.Artists[0]
+			}
+		}
+		next.Title = html.EscapeString(next.Artist + "[" + next.Song + "]")
 		next.UUID = message.UUID
-		err := os.MkdirAll(next.UUID, 0777)
+		next.URL = "https://www.youtube.com/watch?v=" + next.ID
+		next.Album = o.album(vJson.PlaylistID).Title
+		if !vv.Snippet.PublishedAt.IsZero() {
+			next.Year = vv.Snippet.PublishedAt.Format("2006")
+		}
+		next.Genre = youtubeCategories[vv.Snippet.CategoryID]
+		if music {
+			if release.Album != "" {
+				next.Album = release.Album
+			}
+			if release.Year != "" {
+				next.Year = release.Year
+			}
+			next.Date = release.Released
+			next.Label = release.Label
+			next.Composer = strings.Join(release.Composers, ", ")
+		}
+		next.Position = 1
+		if vJson.PlaylistID != "" {
+			next.Position = vJson.Position + 1
+			next.Track = next.Position
+			next.TrackTotal = vJson.PlaylistTotal
+		}
+		next.Published = vv.Snippet.PublishedAt
+		next.Duration = parseISODuration(vv.ContentDetails.Duration)
+		if reason := o.Filter.matchVideo(VideoMeta{
+			Published: next.Published,
+			Duration:  next.Duration,
+			Live:      vv.Snippet.LiveBroadcastContent,
+			Allowed:   vv.ContentDetails.RegionRestriction.Allowed,
+			Blocked:   vv.ContentDetails.RegionRestriction.Blocked,
+			Shorts:    isShorts(next.Duration, vv.Snippet.Title, vv.Snippet.Description, vv.Snippet.Tags),
+		}); reason != "" {
+			o.Skip(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: next.ID, Position: next.Position, Song: vv.Snippet.Title}}, reason)
+			continue
+		}
+		if o.Clip != nil {
+			clip, err := o.Clip.fit(next.Duration)
+			if err != nil {
+				o.Skip(next, "clip: "+err.Error())
+				continue
+			}
+			next.Clip = clip
+			next.Duration = clip.length(next.Duration)
+		}
+		if chaptersMode(usr) && next.Clip == nil {
+			next.Chapters = parseChapters(vv.Snippet.Description, next.Duration)
+		}
+		if o.Ordered {
+			next.Ordered = true
+			next.Ready = make(chan struct{})
+		}
+		next.Pictures = vv.Snippet.Thumbnails.urls()
+		if o.AlbumMode && vJson.PlaylistID != "" {
+			album := o.album(vJson.PlaylistID)
+			next.Album = album.Title
+			next.AlbumArtist = album.Artist
+			if len(album.Covers) > 0 {
+				next.Pictures = album.Covers
+			}
+		}
+		// own folder for every video, names by template may be equal
+		next.URLSaved = filepath.Join(next.UUID, next.ID, fileName(next, usr.nameTemplate()))
+		err := os.MkdirAll(filepath.Dir(next.URLSaved), 0777)
 		if err != nil {
 			next.toLog(err.Error(), true)
 		}
-		next.URLSaved = filepath.Join(next.UUID, next.Artist+"__"+next.Song+"__"+next.ID)
-		if vv.Snippet.Thumbnails.Maxres.URL != "" {
-			next.PicturePath = vv.Snippet.Thumbnails.Maxres.URL
-		} else {
-			next.PicturePath = vv.Snippet.Thumbnails.High.URL
+		if o.Exist(next) {
+			o.Skip(next, "double")
+			continue
 		}
-		if !o.Exist(next) {
-			next.M.RLock()
+		if o.Hold {
+			o.M.Lock()
 			o.Result = append(o.Result, next)
-			next.M.RUnlock()
-			T.Add(next, o.DownloadWrapperTask, message)
+			o.M.Unlock()
+			continue
 		}
+		if !o.reserve(T, next, usr, message) {
+			continue
+		}
+		o.M.Lock()
+		o.Result = append(o.Result, next)
+		o.M.Unlock()
+		T.Add(next, o.DownloadWrapperTask, message)
 	}
 }
 
 // DownloadWrapperTask(*Tasker, Thing, *Message)
-// download all elements (mp4, jpg, convert to mp3)
+// download all elements (mp4, jpg, convert to audio)
 func (o *Query) DownloadWrapperTask(T *Tasker, task Thing, message *Message) {
 	infoLabel := "⚠"
 	select {
@@ -329,26 +644,69 @@ func (o *Query) DownloadWrapperTask(T *Tasker, task Thing, message *Message) {
 	default:
 	}
 	v := task.Input.(*JsonPls)
-	if existFile(v.URLSaved+mp4) == "" && existFile(v.URLSaved+mp3) == "" {
+	usr := GetCtx[*botUser](T, userParam, message)
+	queued := false
+	defer func() {
+		if !queued {
+			v.done()
+		}
+	}()
+	if existFile(v.URLSaved+mp4) == "" && existFile(v.URLSaved+usr.audioFormat().Ext) == "" {
 		client := youtube.Client{}
 		video, err := client.GetVideo(v.ID)
 		if err != nil {
 			v.toLog(err.Error(), true)
 		}
-		formats := video.Formats.WithAudioChannels()
-		usr := GetCtx[*botUser](T, userParam, message)
-		atype, _ := strconv.Atoi(usr.getParameter(paramParam, paramTypeVideo))
-		audio := formats.Itag(atype)
+		mp3Mode := sBool(usr.getParameter(paramParam, mp3))
+		var formats youtube.FormatList
+		if video != nil {
+			formats = video.Formats.WithAudioChannels()
+			// video only stream from format picker, merged with best audio
+			if picked := video.Formats.Itag(o.Itag); !mp3Mode && len(picked) > 0 && picked[0].AudioChannels == 0 {
+				if af := pickAdaptiveAudio(video.Formats, &picked[0]); af != nil {
+					queued = o.startAdaptive(T, v, &client, video, &picked[0], af, usr, message)
+					return
+				}
+			}
+			if height := adaptiveHeight(usr.getParameter(paramParam, paramTypeVideo)); height > 0 && o.Itag == 0 {
+				if vf, af := pickAdaptive(video.Formats, height); vf != nil {
+					queued = o.startAdaptive(T, v, &client, video, vf, af, usr, message)
+					return
+				}
+				v.toLog("no adaptive streams")
+			}
+		}
+		chain := usr.qualityChain()
+		if o.Itag != 0 {
+			chain = append([]QualityRule{{Itag: o.Itag}}, chain...)
+		}
+		audio, rule := selectFormat(formats, chain)
 		if audio != nil {
-			v.URLDl, err = client.GetStreamURL(video, &audio[0])
+			if rule > 0 {
+				v.toLog(sprintf("quality fallback: %s, itag %d", chain[rule], audio.ItagNo))
+			}
+			size := audio.ContentLength
+			if v.Clip != nil {
+				size = v.Clip.part(size, video.Duration)
+				v.ClipVideo = strings.HasPrefix(audio.MimeType, "video") && !mp3Mode
+			}
+			if reason := v.Hold.reserve(usr, Quota{Bytes: size}); reason != "" {
+				v.Reason = "quota: " + reason
+				v.toLog(v.Reason, true)
+				o.quotaExceeded(T, reason, message)
+				return
+			}
+			v.Size = size
+			v.URLDl, err = client.GetStreamURL(video, audio)
 			if err != nil {
 				v.toLog(err.Error(), true)
 			}
 			if !sBool(usr.getParameter(paramParam, mp3)) && !sBool(usr.getParameter(paramParam, mp4)) {
 				message.ReplyMarkup = Buttons{}
 				message.DelAfter = false
-				message.Text = `<a href="` + v.URLDl + `">` + v.Artist + " [" + v.Song + `]</a>`
+				message.Text = `<a href="` + v.URLDl + `">` + html.EscapeString(v.Artist+" ["+v.Song+"]") + `</a>`
 				message.extensionMessaging(T, sendParam, false, message.sendMessage)
+				v.Hold.keep()
 				go func() {
 					if !debug {
 						os.RemoveAll(v.UUID)
@@ -358,12 +716,13 @@ func (o *Query) DownloadWrapperTask(T *Tasker, task Thing, message *Message) {
 			}
 			T.Add(v, o.DownloadJpgWrapperTask, message)
 			T.Add(v, o.DownloadMp4WrapperTask, message)
-			T.Add(v, o.DownloadMp3WrapperTask, message)
+			T.Add(v, o.DownloadAudioWrapperTask, message)
+			queued = true
 		} else {
 			v.toLog("Error LINK", true)
 			message.ReplyMarkup = Buttons{}
 			message.DelAfter = false
-			message.Text = message.tr(infoLabel+"[choose other quality] ") + v.Artist + "_" + v.Song
+			message.Text = message.tr(infoLabel+"[choose other quality] ") + html.EscapeString(v.Artist+"_"+v.Song)
 			message.extensionMessaging(T, sendParam, false, message.sendMessage)
 		}
 
@@ -388,12 +747,27 @@ func (o *Query) DownloadMp4WrapperTask(T *Tasker, task Thing, message *Message)
 	default:
 	}
 	v := task.Input.(*JsonPls)
-	DownloadFile(T, v.URLDl, v.URLSaved+mp4, 0, task, message)
+	usr := GetCtx[*botUser](T, userParam, message)
+	if v.Clip != nil {
+		DownloadClip(T, task, message)
+	} else {
+		DownloadFile(T, v.URLDl, v.URLSaved+mp4, 0, task, message)
+	}
+	if v.Size == 0 {
+		usr.addUsage(Quota{Bytes: fileSize(v.URLSaved + mp4)})
+	}
+	if !sBool(usr.getParameter(paramParam, mp3)) {
+		// video is the result, wait retries of download
+		if GetCtx[bool](T, v.URLSaved+mp4, message) && existFile(v.URLSaved+mp4) != "" {
+			v.Hold.keep()
+		}
+		v.done()
+	}
 }
 
-// DownloadMp3WrapperTask(*Tasker, Thing, *Message)
-// wrapper for mp3 converting
-func (*Query) DownloadMp3WrapperTask(T *Tasker, task Thing, message *Message) {
+// DownloadAudioWrapperTask(*Tasker, Thing, *Message)
+// wrapper for audio converting
+func (o *Query) DownloadAudioWrapperTask(T *Tasker, task Thing, message *Message) {
 	select {
 	case <-T.Branch.Context.Done():
 		return
@@ -401,21 +775,46 @@ func (*Query) DownloadMp3WrapperTask(T *Tasker, task Thing, message *Message) {
 	}
 	v := task.Input.(*JsonPls)
 	usr := GetCtx[*botUser](T, userParam, message)
+	format := usr.audioFormat()
 	if sBool(usr.getParameter(paramParam, mp3)) {
-		ConvertToMp3(T, task, 0, message)
-		if !debug {
-			sendFiles(T, task, mp3, message)
+		mode := usr.loudnessMode()
+		measureSource(v, mode)
+		ConvertAudio(T, task, 0, format, message)
+		if existFile(v.URLSaved+format.Ext) != "" {
+			v.Hold.keep()
+		}
+		var album *Loudness
+		if mode == loudnessGain && existFile(v.URLSaved+format.Ext) != "" {
+			var err error
+			if album, err = applyReplayGain(v, format, nil); err != nil {
+				v.toLog("loudness: "+err.Error(), true)
+			}
+		}
+		// chapters of clip are not valid: timestamps are of whole video
+		if chaptersMode(usr) && v.Clip == nil && existFile(v.URLSaved+format.Ext) != "" {
+			if len(v.Chapters) == 0 && v.Duration >= chapterWebDuration {
+				v.Chapters = webChapters(v.ID, v.Duration)
+			}
+			if len(v.Chapters) > 0 {
+				v.Parts = SplitChapters(T, v, format, usr.nameTemplate())
+			}
+			if album != nil {
+				partsGain(v, format, album) // whole video is album of chapters
+			}
+		}
+		v.done()
+		if !debug && !v.Ordered {
+			sendFiles(T, task, format.Ext, message)
 		}
 	} else {
-		message.AddCtx(T, paramGood+v.URLSaved+mp3, true)
+		message.AddCtx(T, paramGood+v.URLSaved+format.Ext, true)
 	}
 }
 
 // DownloadJpgWrapperTask(*Tasker, Thing, *Message)
 // wrapper for picture downloading
 func (*Query) DownloadJpgWrapperTask(T *Tasker, task Thing, message *Message) {
-	v := task.Input.(*JsonPls)
-	DownloadFile(T, v.PicturePath, v.URLSaved+jpg, 0, task, message)
+	DownloadCover(T, task, message)
 }
 
 // Write([]byte) (int, error)
@@ -561,6 +960,15 @@ func load(url string, w *io.PipeWriter, begin int64, counter *WriteCounter) {
 	}
 }
 
+// downloadType(string) string
+// extension of downloaded file, names may have dots ("Mr. Brightside", "feat.")
+func downloadType(to string) string {
+	if ext := filepath.Ext(to); ext != "" {
+		return ext
+	}
+	return ".unknown"
+}
+
 // DownloadFile(*Tasker, string, string, int, Thing, *Message)
 // initialization downloading files
 func DownloadFile(T *Tasker, from, to string, try int, task Thing, message *Message) {
@@ -576,16 +984,12 @@ func DownloadFile(T *Tasker, from, to string, try int, task Thing, message *Mess
 	versions[message.tr("cancel")] = "/" + commandCancel + message.UUID
 	// Counter init
 	counter := &WriteCounter{Tasker: T, PartSize: partSize, File: initScrFile(to, from), Done: make(chan bool), Message: Message{MinimalMessage: MinimalMessage{MessageId: message.MessageId, ChatID: message.ChatID, Text: "0 %", ReturnMessageId: message.MessageId, ParseMode: "HTML"}, ReplyMarkup: Button{InlineKeyboard: buttomsMap(versions)}}}
-	mask := regexp.MustCompile(`\..+$`)
-	counter.Type = mask.FindString(to)
-	if counter.Type == "" {
-		counter.Type = ".unknown"
-	}
-	mask = regexp.MustCompile(`[\\/]`)
+	counter.Type = downloadType(to)
+	mask := regexp.MustCompile(`[\\/]`)
 	tempSplit := strings.Split(mask.ReplaceAllString(to, delimeterString), delimeterString)
 	switch {
 	case len(tempSplit) >= 1:
-		counter.Title = tempSplit[len(tempSplit)-1]
+		counter.Title = html.EscapeString(tempSplit[len(tempSplit)-1])
 	default:
 		counter.Title = message.tr("Error name")
 	}
@@ -597,74 +1001,6 @@ func DownloadFile(T *Tasker, from, to string, try int, task Thing, message *Mess
 	case strings.HasSuffix(to, mp4):
 		written, err = io.Copy(counter.File.File, pr)
 		defer counter.File.File.Close()
-	case strings.HasSuffix(to, jpg):
-		// Download front JPG
-		my_image, err := jpeg.Decode(pr)
-		if my_image != nil && err == nil {
-			bounds := my_image.Bounds()
-			calcXY := func(a, bmin, bmax int, aIsY bool) int {
-				if bmin > bmax {
-					for b := bmin; b > bmax; b-- {
-						aa, bb, cc, dd := a, b, a, b-1
-						ee := &dd
-						if aIsY {
-							aa, bb, cc, dd = b, a, b-1, a
-							ee = &cc
-						}
-						r1, g1, b1, _ := my_image.At(aa, bb).RGBA()
-						r2, g2, b2, _ := my_image.At(cc, dd).RGBA()
-						if r1 != r2 && g1 != g2 && b1 != b2 {
-							return *ee
-						}
-					}
-				} else {
-					for b := bmin; b < bmax; b++ {
-						aa, bb, cc, dd := a, b, a, b+1
-						ee := &dd
-						if aIsY {
-							aa, bb, cc, dd = b, a, b+1, a
-							ee = &cc
-						}
-						r1, g1, b1, _ := my_image.At(aa, bb).RGBA()
-						r2, g2, b2, _ := my_image.At(cc, dd).RGBA()
-						if r1 != r2 && g1 != g2 && b1 != b2 {
-							return *ee
-						}
-					}
-				}
-				return 0
-			}
-			if err != nil {
-				toLog(err.Error())
-			}
-			my_sub_image := my_image.(interface {
-				SubImage(r image.Rectangle) image.Image
-			}).SubImage(image.Rect(calcXY(bounds.Max.Y/2, bounds.Min.X+1, bounds.Max.X, true), calcXY(bounds.Max.X/2, bounds.Min.Y+1, bounds.Max.Y, false), calcXY(bounds.Max.Y/2, bounds.Max.X-1, bounds.Min.X, true), calcXY(bounds.Max.X/2, bounds.Max.Y-1, bounds.Min.Y, false)))
-			err = jpeg.Encode(counter.File.File, my_sub_image, nil)
-			if err != nil {
-				toLog(err.Error())
-			}
-			defer counter.File.File.Close()
-		} else {
-			// if picture not found in normal quality for example will create dummy picture
-			myImg := image.NewRGBA(image.Rect(0, 0, 350, 350))
-			d := myImg.Bounds().Dx()
-			for by := 0; by < 350; by++ {
-				for bx := 0; bx < 350; bx++ {
-					xx, yy, rr := float64(bx-d/2)+0.5, float64(by-d/2)+0.5, float64(d/2)
-					if xx*xx+yy*yy < rr*rr {
-						myImg.Set(bx, by, color.RGBA{255, 99, 71, 0xff})
-					} else {
-						myImg.Set(bx, by, color.RGBA{34, 139, 87, 0xff})
-					}
-				}
-			}
-			err = jpeg.Encode(counter.File.File, myImg, nil)
-			if err != nil {
-				toLog(err.Error())
-			}
-			defer counter.File.File.Close()
-		}
 	default:
 	}
 	if err != nil {
@@ -684,7 +1020,7 @@ func DownloadFile(T *Tasker, from, to string, try int, task Thing, message *Mess
 		}
 	}
 	message.AddCtx(T, to, download)
-	if !debug {
+	if v, ok := task.Input.(*JsonPls); !debug && !(ok && v.Ordered && counter.Type != jpg) {
 		sendFiles(T, task, counter.Type, message)
 	}
 }
@@ -709,9 +1045,10 @@ func (o *WriteCounter) informMessage(task Thing, message *Message) {
 				default:
 					if done && ok {
 						if sBool(user.getParameter(paramParam, mp3)) && o.Type == mp4 {
-							o.Message.Text = o.Title + " <b>" + message.tr("Convertation to MP3") + "</b>"
+							format := user.audioFormat()
+							o.Message.Text = o.Title + " <b>" + message.tr("Convertation to") + " " + format.Title + "</b>"
 							telegramQuery(editParam, o.Message, new(SendMessageReturn), false, "")
-							GetCtx[bool](o.Tasker, taskInput.URLSaved+mp3, message)
+							GetCtx[bool](o.Tasker, taskInput.URLSaved+format.Ext, message)
 						}
 						telegramQuery(delParam, o.Message, new(DeleteMessageReturn), false, "")
 					}
@@ -1,17 +1,19 @@
 package main
 
 import (
-	"math"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// ConvertToMp3(*Tasker, Thing, int, *Message)
-// Using for convert mp4 to mp3
-func ConvertToMp3(T *Tasker, task Thing, try int, message *Message) {
+// ConvertAudio(*Tasker, Thing, int, AudioFormat, *Message)
+// Using for convert mp4 to audio format with cover and tags
+func ConvertAudio(T *Tasker, task Thing, try int, format AudioFormat, message *Message) {
 	defer new(Timer).Start().Stop()
 	v := task.Input.(*JsonPls)
 	select {
@@ -20,134 +22,230 @@ func ConvertToMp3(T *Tasker, task Thing, try int, message *Message) {
 	default:
 	}
 	if GetCtx[bool](T, v.URLSaved+jpg, message) && GetCtx[bool](T, v.URLSaved+mp4, message) && existFile(v.URLSaved+jpg) != "" && existFile(v.URLSaved+mp4) != "" {
-		if existFile(v.URLSaved+mp3) != "" {
-			os.Remove(v.URLSaved + mp3)
+		if existFile(v.URLSaved+format.Ext) != "" {
+			os.Remove(v.URLSaved + format.Ext)
 		}
 		var args []string
 		args = append(args, "-i")
 		args = append(args, v.URLSaved+mp4)
-		args = append(args, "-i")
-		args = append(args, v.URLSaved+jpg)
-		args = append(args, "-map")
-		args = append(args, "0")
+		// tags and cover are written after conversion
 		args = append(args, "-map")
-		args = append(args, "1")
-		args = append(args, "-metadata")
-		args = append(args, `title=`+v.Song)
-		args = append(args, "-metadata")
-		args = append(args, `artist=`+v.Artist)
-		args = append(args, "-metadata")
-		args = append(args, `track=`+v.ID)
-		args = append(args, v.URLSaved+mp3)
+		args = append(args, "0:a")
+		args = append(args, "-map_metadata")
+		args = append(args, "-1")
+		if format.Ext == mp3 {
+			args = append(args, "-write_id3v1")
+			args = append(args, "0")
+		}
+		if v.Loudnorm != nil {
+			// normalization is done in this encoding, converted audio is not encoded twice
+			args = append(args, format.Args...)
+			args = append(args, normalizeArgs(v, format)...)
+		} else if format.Copy != "" && FfprobeCodec(v.URLSaved+mp4) == format.Copy {
+			args = append(args, "-c:a")
+			args = append(args, "copy")
+		} else {
+			args = append(args, format.Args...)
+		}
+		args = append(args, v.URLSaved+format.Ext)
 		err := exec.Command("ffmpeg", args...).Run()
 		if err != nil {
-			v.toLog(mp3, true)
+			v.toLog(format.Ext, true)
 			if try <= tryingDownload {
-				ConvertToMp3(T, task, try+1, message)
+				ConvertAudio(T, task, try+1, format, message)
 			} else {
-				message.AddCtx(T, v.URLSaved+mp3, true)
+				message.AddCtx(T, v.URLSaved+format.Ext, true)
 			}
 		} else {
-			v.toLog(mp3)
-			message.AddCtx(T, v.URLSaved+mp3, true)
+			if err := writeTrackTags(v.URLSaved+format.Ext, trackTags(v), v.URLSaved+jpg); err != nil {
+				v.toLog("tags: "+err.Error(), true)
+			}
+			if v.Loudnorm != nil {
+				v.Loudness = sprintf("%.1f LUFS → %.1f LUFS", v.Loudnorm.Input, loudnessTarget)
+				v.toLog("loudness: " + v.Loudness)
+			}
+			v.toLog(format.Ext)
+			message.AddCtx(T, v.URLSaved+format.Ext, true)
 		}
 	}
 }
 
-// SplitMp(*Tasker, Thing, int, int64, string, *Message)
-// Using for partialing files, if size more than limit
-func SplitMp(T *Tasker, task Thing, try int, limit int64, format string, message *Message) {
+// SplitMp(*Tasker, Thing, int, int64, string, *Message) error
+// Using for partialing files, if size more than limit. Parts are cut near silence (audio) or keyframes (video), get "(Part N/M)" title, keep cover and tags. File is split again with more parts while some part is bigger than limit
+func SplitMp(T *Tasker, task Thing, try int, limit int64, format string, message *Message) error {
 	defer new(Timer).Start().Stop()
 	v := task.Input.(*JsonPls)
 	select {
 	case <-T.Branch.Context.Done():
-		return
+		return T.Branch.Context.Err()
 	default:
 	}
-	if GetCtx[bool](T, v.URLSaved+jpg, message) && GetCtx[bool](T, v.URLSaved+format, message) && existFile(v.URLSaved+jpg) != "" && existFile(v.URLSaved+format) != "" {
+	src := v.URLSaved + format
+	if existFile(src) == "" {
+		return errors.New("file not found " + filepath.Base(src))
+	}
+	total := FfprobeDuration(src)
+	if total == 0 {
+		return errors.New("unknown duration of " + filepath.Base(src))
+	}
+	var candidates []time.Duration
+	if isVideoExt(format) {
+		candidates = keyframePoints(src)
+	} else {
+		candidates = silencePoints(src)
+	}
+	for n := splitCount(fileSize(src), limit); n <= maxSplitParts; n++ {
+		parts, err := cutParts(T, v, format, splitPoints(total, n, candidates, splitWindow))
+		if err != nil {
+			removeFiles(parts)
+			v.toLog(format+" fail split", true)
+			if try < tryingDownload {
+				return SplitMp(T, task, try+1, limit, format, message)
+			}
+			return err
+		}
+		if biggest := maxFileSize(parts); biggest >= limit {
+			v.toLog(sprintf("%s part %d bytes, split to %d", format, biggest, n+1), true)
+			removeFiles(parts)
+			continue
+		}
+		v.toLog(format + sprintf(" split %d", n))
+		for _, val := range parts {
+			message.AddCtx(T, val, true)
+		}
+		if !debug {
+			os.Remove(src)
+			os.Remove(v.URLSaved + jpg)
+			os.Remove(v.URLSaved + mp4)
+		}
+		return nil
+	}
+	return errors.New(sprintf("parts are bigger than %d MB", limit/1000000))
+}
+
+// cutParts(*Tasker, *JsonPls, string, []time.Duration) ([]string, error)
+// cut file by points without re-encoding, return created parts
+func cutParts(T *Tasker, v *JsonPls, format string, points []time.Duration) ([]string, error) {
+	var parts []string
+	n := len(points) - 1
+	for k := 0; k < n; k++ {
+		select {
+		case <-T.Branch.Context.Done():
+			return parts, T.Branch.Context.Err()
+		default:
+		}
+		title := partTitle(v.Song, k+1, n)
+		out := v.URLSaved + sprintf("__%04d", k) + format
 		var args []string
+		args = append(args, "-ss")
+		args = append(args, sprintf("%.3f", points[k].Seconds()))
+		if k+1 < n {
+			args = append(args, "-to")
+			args = append(args, sprintf("%.3f", points[k+1].Seconds()))
+		}
 		args = append(args, "-i")
 		args = append(args, v.URLSaved+format)
-		args = append(args, "-c")
-		args = append(args, "copy")
 		args = append(args, "-map")
 		args = append(args, "0")
-		args = append(args, "-segment_time")
-		args = append(args, FfprobeSize(T, v.URLSaved+format, limit))
-		args = append(args, "-f")
-		args = append(args, "segment")
+		args = append(args, "-c")
+		args = append(args, "copy")
+		args = append(args, "-metadata")
+		args = append(args, "title="+title)
+		if format == ogg {
+			// vorbis comments are stream metadata
+			args = append(args, "-metadata:s:a:0")
+			args = append(args, "title="+title)
+		}
+		if format == mp3 {
+			args = append(args, "-id3v2_version")
+			args = append(args, "4")
+			args = append(args, "-write_id3v1")
+			args = append(args, "0")
+		}
 		args = append(args, "-reset_timestamps")
 		args = append(args, "1")
-		args = append(args, v.URLSaved+"__%04d"+format)
-		err := exec.Command("ffmpeg", args...).Run()
-		if err != nil {
-			v.toLog(format+" fail split", true)
-			if try <= tryingDownload {
-				SplitMp(T, task, try+1, limit, format, message)
-			} else {
-			}
-		} else {
-			v.toLog(format + " split")
-			for _, val := range searchFiles(v.URLSaved+"__", v.UUID, format) {
-				message.AddCtx(T, val, true)
-			}
-			go func() {
-				if !debug {
-					os.Remove(v.URLSaved + jpg)
-					timeout := false
-					var notfound = make(chan struct{})
-					go func() {
-						for {
-							select {
-							case <-T.Branch.Context.Done():
-								break
-							default:
-								if os.Remove(v.URLSaved+format) == nil || timeout {
-									notfound <- struct{}{}
-									close(notfound)
-									return
-								}
-							}
-						}
-					}()
-					select {
-					case <-time.After(10 * time.Minute):
-						timeout = true
-					case <-notfound:
-					}
-					os.Remove(v.URLSaved + mp4)
-					os.Remove(v.UUID)
-				}
-			}()
+		args = append(args, "-y")
+		args = append(args, out)
+		if err := exec.Command("ffmpeg", args...).Run(); err != nil {
+			return parts, fmt.Errorf("part %d/%d: %w", k+1, n, err)
 		}
+		parts = append(parts, out)
 	}
+	return parts, nil
 }
 
-// ffprobeSize(*Tasker, string, int64) string
-// function use for calc file size
-func FfprobeSize(T *Tasker, url string, limit int64) string {
-	defer new(Timer).Start().Stop()
-	select {
-	case <-T.Branch.Context.Done():
-		return ""
-	default:
+// FfprobeDuration(string) time.Duration
+// duration of media file, 0 if unknown
+func FfprobeDuration(url string) time.Duration {
+	var args []string
+	args = append(args, "-v")
+	args = append(args, "error")
+	args = append(args, "-show_entries")
+	args = append(args, "format=duration")
+	args = append(args, "-of")
+	args = append(args, "default=noprint_wrappers=1:nokey=1")
+	args = append(args, url)
+	out, _ := exec.Command("ffprobe", args...).Output()
+	sec, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0
 	}
-	var chunks int64
-	if fileSize(url)/limit != 0 {
-		chunks = (fileSize(url) / limit) + 1
-	} else {
-		chunks = (fileSize(url) / limit)
+	return time.Duration(sec * float64(time.Second))
+}
+
+// silencePoints(string) []time.Duration
+// middles of silences in audio
+func silencePoints(url string) []time.Duration {
+	var args []string
+	args = append(args, "-i")
+	args = append(args, url)
+	args = append(args, "-af")
+	args = append(args, "silencedetect=noise="+silenceNoise+":d=0.3")
+	args = append(args, "-f")
+	args = append(args, "null")
+	args = append(args, "-")
+	out, _ := exec.Command("ffmpeg", args...).CombinedOutput()
+	return parseSilence(string(out))
+}
+
+// keyframePoints(string) []time.Duration
+// times of video keyframes, copy cut is exact only there
+func keyframePoints(url string) []time.Duration {
+	var args []string
+	args = append(args, "-v")
+	args = append(args, "error")
+	args = append(args, "-select_streams")
+	args = append(args, "v:0")
+	args = append(args, "-skip_frame")
+	args = append(args, "nokey")
+	args = append(args, "-show_entries")
+	args = append(args, "frame=pts_time")
+	args = append(args, "-of")
+	args = append(args, "csv=p=0")
+	args = append(args, url)
+	out, _ := exec.Command("ffprobe", args...).Output()
+	var ret []time.Duration
+	for _, line := range strings.Fields(string(out)) {
+		if sec, err := strconv.ParseFloat(strings.Trim(line, ","), 64); err == nil {
+			ret = append(ret, time.Duration(sec*float64(time.Second)))
+		}
 	}
+	return ret
+}
+
+// FfprobeCodec(string) string
+// codec name of first audio stream
+func FfprobeCodec(url string) string {
 	var args []string
 	args = append(args, "-v")
 	args = append(args, "error")
+	args = append(args, "-select_streams")
+	args = append(args, "a:0")
 	args = append(args, "-show_entries")
-	args = append(args, "format=duration")
+	args = append(args, "stream=codec_name")
 	args = append(args, "-of")
 	args = append(args, "default=noprint_wrappers=1:nokey=1")
 	args = append(args, url)
-	size, _ := exec.Command("ffprobe", args...).Output()
-	i, _ := strconv.ParseFloat(strings.TrimSpace(string(size)), 10)
-	j := int64(math.Round(i)) / chunks
-	return sprintf("%02d:%02d:%02d", j/3600, (j % 3600 / 60), ((j % 3600) % 60))
+	codec, _ := exec.Command("ffprobe", args...).Output()
+	return strings.TrimSpace(string(codec))
 }
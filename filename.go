@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	paramNameTemplate   = "name_template"
+	defaultNameTemplate = "{artist} - {title}"
+	// maxNameBytes - file name limit (255 bytes on Linux) minus split suffix and longest temporary extension
+	maxNameBytes = 255 - len("__0000") - len(".flac.tags")
+)
+
+// reTemplateField - {field} or {field:0N}
+var reTemplateField = regexp.MustCompile(`\{(\w+)(?::0?(\d))?\}`)
+
+// fileNameFields - placeholders of filename template
+var fileNameFields = []string{"artist", "title", "album", "year", "num", "id"}
+
+// sanitizeFileName(string) string
+// remove only characters which are unsafe for filesystems, truncate to byte limit by whole runes
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(reSpaces.ReplaceAllString(name, " "), " .")
+	for len(name) > maxNameBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return strings.TrimRight(name, " .")
+}
+
+// fileName(*JsonPls, string) string
+// file name (without extension) by template
+func fileName(v *JsonPls, template string) string {
+	if template == "" {
+		template = defaultNameTemplate
+	}
+	num := v.Track
+	if num == 0 {
+		num = 1
+	}
+	name := reTemplateField.ReplaceAllStringFunc(template, func(s string) string {
+		m := reTemplateField.FindStringSubmatch(s)
+		switch m[1] {
+		case "artist":
+			return v.Artist
+		case "title":
+			return v.Song
+		case "album":
+			return v.Album
+		case "year":
+			return v.Year
+		case "id":
+			return v.ID
+		case "num":
+			width, _ := strconv.Atoi(m[2])
+			return sprintf("%0*d", width, num)
+		}
+		return s
+	})
+	if name = sanitizeFileName(name); name == "" {
+		return v.ID
+	}
+	return name
+}
+
+// checkNameTemplate(string) string
+// unknown placeholder of template, empty if template is good
+func checkNameTemplate(template string) string {
+	for _, m := range reTemplateField.FindAllStringSubmatch(template, -1) {
+		known := false
+		for _, f := range fileNameFields {
+			known = known || m[1] == f
+		}
+		if !known {
+			return m[0]
+		}
+	}
+	return ""
+}
+
+// nameTemplate() string
+// filename template chosen by user
+func (o *botUser) nameTemplate() string {
+	if t := o.getParameter(paramParam, paramNameTemplate); t != "" {
+		return t
+	}
+	return defaultNameTemplate
+}
+
+// addNameTemplateCommands(*Commands, *Tasker)
+// command 'filename' for user filename template
+func (obj *Action) addNameTemplateCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandNameTemplate, "✏filename", false, false, func(message Message, usr *botUser) {
+		arg := commandArgument(message, commandNameTemplate)
+		message.DelBefore = true
+		switch {
+		case arg == "":
+			message.Text = message.tr("Filename template") + ": <code>" + html.EscapeString(usr.nameTemplate()) + "</code>\n" +
+				message.tr("Fields") + ": {" + strings.Join(fileNameFields, "} {") + "}, {num:02}\n" +
+				"<code>/" + commandNameTemplate + " {num:02} {artist} - {title}</code>\n" +
+				"<code>/" + commandNameTemplate + " reset</code>"
+		case arg == "reset":
+			usr.setParameter(paramParam, paramNameTemplate, defaultNameTemplate)
+			message.Text = message.tr("Filename template") + ": <code>" + html.EscapeString(defaultNameTemplate) + "</code>"
+		case checkNameTemplate(arg) != "":
+			message.Text = infoLabel + message.tr("Unknown field") + ": " + html.EscapeString(checkNameTemplate(arg))
+		default:
+			usr.setParameter(paramParam, paramNameTemplate, arg)
+			message.Text = message.tr("Filename template") + ": <code>" + html.EscapeString(arg) + "</code>"
+		}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
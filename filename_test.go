@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_fileName(t *testing.T) {
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Artist: "AC/DC", Song: "Rock 'n' Roll Ain't Noise Pollution!"}, Album: "Back in Black", Year: "1980", Track: 10}
+	for template, want := range map[string]string{
+		"":                           "AC_DC - Rock 'n' Roll Ain't Noise Pollution!",
+		"{num:02} {title}":           "10 Rock 'n' Roll Ain't Noise Pollution!",
+		"{num:03}. {artist}":         "010. AC_DC",
+		"{year} {album} [{id}]":      "1980 Back in Black [abc123]",
+		"{artist}: {unknown}":        "AC_DC_ {unknown}",
+		"  ..{album}\t\n{year}.. ":   "Back in Black 1980",
+		"{artist} <{title}>?*|\"\\ ": "AC_DC _Rock 'n' Roll Ain't Noise Pollution!______",
+	} {
+		if got := fileName(v, template); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", template, got, want)
+		}
+	}
+	if got := fileName(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123"}}, "{album}"); got != "abc123" {
+		t.Errorf("empty name = %q, want ID", got)
+	}
+}
+
+func Test_sanitizeFileName_truncate(t *testing.T) {
+	got := sanitizeFileName(strings.Repeat("Ёж", 200))
+	if len(got) > maxNameBytes || !utf8.ValidString(got) {
+		t.Errorf("len %d, valid %v", len(got), utf8.ValidString(got))
+	}
+	if got := sanitizeFileName("Привет, мир – 東京"); got != "Привет, мир – 東京" {
+		t.Errorf("unicode changed: %q", got)
+	}
+}
+
+func Test_checkNameTemplate(t *testing.T) {
+	if f := checkNameTemplate("{num:02} {artist} - {title}"); f != "" {
+		t.Errorf("good template rejected: %s", f)
+	}
+	if f := checkNameTemplate("{artist} {genre}"); f != "{genre}" {
+		t.Errorf("got %q, want {genre}", f)
+	}
+}
+
+func Test_downloadType(t *testing.T) {
+	for _, tt := range []struct {
+		artist, song, ext string
+	}{
+		{"The Killers", "Mr. Brightside", mp4},
+		{"X feat. Y", "Z", mp4},
+		{"Artist", "Song", jpg},
+	} {
+		v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Artist: tt.artist, Song: tt.song}}
+		to := filepath.Join("uuid", v.ID, fileName(v, defaultNameTemplate)) + tt.ext
+		if got := downloadType(to); got != tt.ext {
+			t.Errorf("downloadType(%q) = %q, want %q", to, got, tt.ext)
+		}
+	}
+	if got := downloadType("uuid/name"); got != ".unknown" {
+		t.Errorf("downloadType() without extension = %q", got)
+	}
+}
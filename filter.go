@@ -0,0 +1,394 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	paramFilter = "filter_defaults"
+	// shortsMaxDuration - videos not longer are shorts even without #shorts
+	shortsMaxDuration = 60 * time.Second
+	// shortsTagDuration - longest shorts, need #shorts in title, tags or description
+	shortsTagDuration = 3 * time.Minute
+	// skippedListSize - skipped elements listed by name in summary
+	skippedListSize = 20
+)
+
+// region - country (ISO 3166-1 alpha-2) for 'skip blocked', env REGION
+var region = ""
+
+// PlaylistFilter - selectors after playlist link, like "1-20 max 8m skip live"
+type PlaylistFilter struct {
+	Ranges      [][2]int // playlist positions from 1, inclusive. 0 - open end
+	First       int
+	Last        int
+	Since       time.Time
+	Until       time.Time
+	Max         time.Duration
+	Min         time.Duration
+	SkipLive    bool
+	SkipShorts  bool
+	SkipBlocked bool
+}
+
+// VideoMeta - video information checked by filter
+type VideoMeta struct {
+	Published time.Time
+	Duration  time.Duration
+	Live      string // liveBroadcastContent: none, live, upcoming
+	Allowed   []string
+	Blocked   []string
+	Shorts    bool
+}
+
+// filterHelp - grammar of selectors
+const filterHelp = `<b>Playlist selectors</b> (after link, any order):
+<code>1-20</code> - positions, also <code>5</code>, <code>30-</code>, <code>1-5,9,12-14</code>
+<code>first 10</code>, <code>last 10</code> - first/last tracks of playlist
+<code>since 2024-01-01</code>, <code>until 2024-12-31</code> - video publish date
+<code>max 8m</code>, <code>min 30s</code> - duration (<code>1h20m</code>, <code>3:30</code>)
+<code>skip live</code> - skip live and upcoming streams
+<code>skip shorts</code> - skip shorts
+<code>skip blocked</code> - skip videos blocked in bot region
+Defaults for every link: <code>/limits max 15m skip live</code>
+Example: <code>https://www.youtube.com/playlist?list=... last 10 max 8m</code>`
+
+var reRange = regexp.MustCompile(`^(\d+)(-(\d*))?$`)
+
+// parseFilterDuration(string) (time.Duration, error)
+// duration like 8m, 1h20m, 90s, 3:30, 1:02:03
+func parseFilterDuration(s string) (time.Duration, error) {
+	if strings.Contains(s, ":") {
+		var d time.Duration
+		for _, part := range strings.Split(s, ":") {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return 0, errors.New("wrong duration " + s)
+			}
+			d = d*60 + time.Duration(n)*time.Second
+		}
+		return d, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("wrong duration " + s)
+	}
+	return d, nil
+}
+
+// parsePlaylistFilter(string) (*PlaylistFilter, error)
+// selectors from text, nil filter for empty text
+func parsePlaylistFilter(text string) (*PlaylistFilter, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	f := new(PlaylistFilter)
+	next := func(i *int, name string) (string, error) {
+		if *i+1 >= len(fields) {
+			return "", errors.New(name + ": value required")
+		}
+		*i++
+		return fields[*i], nil
+	}
+	for i := 0; i < len(fields); i++ {
+		var val string
+		var err error
+		switch word := fields[i]; word {
+		case "first", "last":
+			if val, err = next(&i, word); err != nil {
+				return nil, err
+			}
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, errors.New(word + ": wrong number " + val)
+			}
+			if word == "first" {
+				f.First = n
+			} else {
+				f.Last = n
+			}
+		case "since", "until":
+			if val, err = next(&i, word); err != nil {
+				return nil, err
+			}
+			t, err := time.Parse("2006-01-02", val)
+			if err != nil {
+				return nil, errors.New(word + ": wrong date " + val + ", use YYYY-MM-DD")
+			}
+			if word == "since" {
+				f.Since = t
+			} else {
+				f.Until = t.Add(24*time.Hour - time.Nanosecond)
+			}
+		case "max", "min":
+			if val, err = next(&i, word); err != nil {
+				return nil, err
+			}
+			d, err := parseFilterDuration(val)
+			if err != nil {
+				return nil, err
+			}
+			if word == "max" {
+				f.Max = d
+			} else {
+				f.Min = d
+			}
+		case "skip":
+			if val, err = next(&i, word); err != nil {
+				return nil, err
+			}
+			switch val {
+			case "live":
+				f.SkipLive = true
+			case "shorts":
+				f.SkipShorts = true
+			case "blocked":
+				f.SkipBlocked = true
+			default:
+				return nil, errors.New("skip: unknown value " + val)
+			}
+		default:
+			for _, part := range strings.Split(word, ",") {
+				if part == "" {
+					continue
+				}
+				m := reRange.FindStringSubmatch(part)
+				if m == nil {
+					return nil, errors.New("unknown selector " + part)
+				}
+				from, _ := strconv.Atoi(m[1])
+				to := from
+				if m[2] != "" {
+					to, _ = strconv.Atoi(m[3]) // empty - open end
+				}
+				if from == 0 || (to != 0 && to < from) {
+					return nil, errors.New("wrong range " + part)
+				}
+				f.Ranges = append(f.Ranges, [2]int{from, to})
+			}
+		}
+	}
+	return f, nil
+}
+
+// matchPosition(int, int) bool
+// check playlist position (from 1) with total count of playlist
+func (f *PlaylistFilter) matchPosition(pos, total int) bool {
+	if f == nil {
+		return true
+	}
+	if f.First > 0 && pos > f.First {
+		return false
+	}
+	if f.Last > 0 && pos <= total-f.Last {
+		return false
+	}
+	if len(f.Ranges) == 0 {
+		return true
+	}
+	for _, r := range f.Ranges {
+		if pos >= r[0] && (r[1] == 0 || pos <= r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastPosition() int
+// last playlist position (from 1) which can match, 0 - any. Next pages are not needed after it
+func (f *PlaylistFilter) lastPosition() int {
+	if f == nil {
+		return 0
+	}
+	last := 0
+	for _, r := range f.Ranges {
+		if r[1] == 0 {
+			last = 0
+			break
+		}
+		last = max(last, r[1])
+	}
+	if f.First > 0 && (last == 0 || f.First < last) {
+		last = f.First
+	}
+	return last
+}
+
+// matchVideo(VideoMeta) string
+// check video metadata, return reason of skipping or empty string
+func (f *PlaylistFilter) matchVideo(v VideoMeta) string {
+	switch {
+	case f == nil:
+	case !f.Since.IsZero() && v.Published.Before(f.Since):
+		return "filter: published before " + f.Since.Format("2006-01-02")
+	case !f.Until.IsZero() && v.Published.After(f.Until):
+		return "filter: published after " + f.Until.Format("2006-01-02")
+	case f.SkipLive && v.Live != "" && v.Live != "none":
+		return "filter: " + v.Live
+	case f.Max > 0 && v.Duration > f.Max:
+		return "filter: longer than " + formatDuration(f.Max)
+	case f.Min > 0 && v.Duration < f.Min:
+		return "filter: shorter than " + formatDuration(f.Min)
+	case f.SkipShorts && v.Shorts:
+		return "filter: shorts"
+	case f.SkipBlocked && blockedIn(region, v.Allowed, v.Blocked):
+		return "filter: blocked in " + region
+	}
+	return ""
+}
+
+// blockedIn(string, []string, []string) bool
+// video is not available in country by regionRestriction
+func blockedIn(country string, allowed, blocked []string) bool {
+	if country == "" {
+		return false
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, country) {
+		return true
+	}
+	return slices.Contains(blocked, country)
+}
+
+// isShorts(time.Duration, string, string, []string) bool
+// API has no shorts flag: very short videos or short videos marked #shorts
+func isShorts(d time.Duration, title, description string, tags []string) bool {
+	if d == 0 || d > shortsTagDuration {
+		return false
+	}
+	if d <= shortsMaxDuration {
+		return true
+	}
+	mark := func(s string) bool { return strings.Contains(strings.ToLower(s), "#shorts") }
+	return mark(title) || mark(description) || slices.ContainsFunc(tags, func(t string) bool {
+		return strings.EqualFold(strings.TrimPrefix(t, "#"), "shorts")
+	})
+}
+
+// merge(*PlaylistFilter) *PlaylistFilter
+// selectors of link over user defaults
+func (f *PlaylistFilter) merge(def *PlaylistFilter) *PlaylistFilter {
+	if f == nil || def == nil {
+		if f == nil {
+			return def
+		}
+		return f
+	}
+	ret := *f
+	if ret.Since.IsZero() {
+		ret.Since = def.Since
+	}
+	if ret.Until.IsZero() {
+		ret.Until = def.Until
+	}
+	if ret.Max == 0 {
+		ret.Max = def.Max
+	}
+	if ret.Min == 0 {
+		ret.Min = def.Min
+	}
+	ret.SkipLive = ret.SkipLive || def.SkipLive
+	ret.SkipShorts = ret.SkipShorts || def.SkipShorts
+	ret.SkipBlocked = ret.SkipBlocked || def.SkipBlocked
+	return &ret
+}
+
+// checkDefaultFilter(string) error
+// defaults for every link, positions make no sense there
+func checkDefaultFilter(text string) error {
+	f, err := parsePlaylistFilter(text)
+	if err != nil {
+		return err
+	}
+	if f != nil && (len(f.Ranges) > 0 || f.First > 0 || f.Last > 0) {
+		return errors.New("positions are allowed only after link")
+	}
+	return nil
+}
+
+// defaultFilter() *PlaylistFilter
+// filter which user applies to every link
+func (o *botUser) defaultFilter() *PlaylistFilter {
+	f, err := parsePlaylistFilter(o.getParameter(paramParam, paramFilter))
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// skippedText(*Message) string
+// skipped elements with reasons for job summary, empty if nothing skipped
+func (o *Query) skippedText(message *Message) string {
+	o.M.RLock()
+	defer o.M.RUnlock()
+	if len(o.Skipped) == 0 {
+		return ""
+	}
+	text := sprintf("%s: %d\n", message.tr("Skipped"), len(o.Skipped))
+	for k, v := range o.Skipped {
+		if k == skippedListSize {
+			text += sprintf("… +%d\n", len(o.Skipped)-k)
+			break
+		}
+		name := v.ID
+		if v.Song != "" {
+			name = v.Song
+		}
+		text += sprintf("<a href=\"https://www.youtube.com/watch?v=%s\">%s</a> - %s\n", v.ID, html.EscapeString(name), html.EscapeString(v.Reason))
+	}
+	return text
+}
+
+// addFilterCommands(*Commands, *Tasker)
+// commands 'filters' (grammar) and 'limits' (user defaults)
+func (obj *Action) addFilterCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandFilters, "🔎filters", false, false, func(message Message, usr *botUser) {
+		message.Text = filterHelp
+		message.DelBefore = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add(commandLimits, "🔎limits", false, false, func(message Message, usr *botUser) {
+		arg := strings.ToLower(commandArgument(message, commandLimits))
+		message.DelBefore = true
+		switch {
+		case arg == "":
+			current := usr.getParameter(paramParam, paramFilter)
+			if current == "" {
+				current = "-"
+			}
+			message.Text = message.tr("Filters for every link") + ": <code>" + html.EscapeString(current) + "</code>\n" +
+				"<code>/" + commandLimits + " max 15m min 30s skip live skip shorts skip blocked</code>\n" +
+				"<code>/" + commandLimits + " reset</code>\n/" + commandFilters
+		case arg == "reset":
+			usr.setParameter(paramParam, paramFilter, "")
+			message.Text = message.tr("Filters for every link") + ": -"
+		case checkDefaultFilter(arg) != nil:
+			message.Text = infoLabel + html.EscapeString(checkDefaultFilter(arg).Error()) + "\n/" + commandFilters
+		default:
+			usr.setParameter(paramParam, paramFilter, strings.Join(strings.Fields(arg), " "))
+			message.Text = message.tr("Filters for every link") + ": <code>" + html.EscapeString(arg) + "</code>"
+		}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
+
+// sendSkipped(*Tasker, *Message)
+// job summary with skipped elements, nothing if all elements are handled
+func (o *Query) sendSkipped(T *Tasker, message *Message) {
+	text := o.skippedText(message)
+	if text == "" {
+		return
+	}
+	m := *message
+	m.ReplyMarkup = Buttons{}
+	m.DelAfter = false
+	m.ParseMode = htmlMode
+	m.Text = infoLabel + text
+	m.extensionMessaging(T, sendParam, false, m.sendMessage)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parsePlaylistFilter(t *testing.T) {
+	date := func(s string) time.Time {
+		v, _ := time.Parse("2006-01-02", s)
+		return v
+	}
+	for _, tt := range []struct {
+		text    string
+		want    *PlaylistFilter
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  ", nil, false},
+		{"1-20", &PlaylistFilter{Ranges: [][2]int{{1, 20}}}, false},
+		{"5 30-", &PlaylistFilter{Ranges: [][2]int{{5, 5}, {30, 0}}}, false},
+		{"1-5,9,12-14", &PlaylistFilter{Ranges: [][2]int{{1, 5}, {9, 9}, {12, 14}}}, false},
+		{"Last 10 max 8m", &PlaylistFilter{Last: 10, Max: 8 * time.Minute}, false},
+		{"first 3 min 3:30", &PlaylistFilter{First: 3, Min: 3*time.Minute + 30*time.Second}, false},
+		{"since 2024-01-01 until 2024-01-31", &PlaylistFilter{Since: date("2024-01-01"), Until: date("2024-02-01").Add(-time.Nanosecond)}, false},
+		{"skip live max 1:02:03", &PlaylistFilter{SkipLive: true, Max: time.Hour + 2*time.Minute + 3*time.Second}, false},
+		{"20-10", nil, true},
+		{"0-5", nil, true},
+		{"last", nil, true},
+		{"last ten", nil, true},
+		{"since 01.01.2024", nil, true},
+		{"max long", nil, true},
+		{"skip shorts skip blocked", &PlaylistFilter{SkipShorts: true, SkipBlocked: true}, false},
+		{"skip all", nil, true},
+		{"everything", nil, true},
+	} {
+		got, err := parsePlaylistFilter(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePlaylistFilter(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if sprintf("%+v", got) != sprintf("%+v", tt.want) {
+			t.Errorf("parsePlaylistFilter(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_PlaylistFilter_match(t *testing.T) {
+	var none *PlaylistFilter
+	if !none.matchPosition(7, 10) || none.matchVideo(VideoMeta{Duration: time.Hour, Live: "live"}) != "" {
+		t.Errorf("nil filter must pass everything")
+	}
+	f, _ := parsePlaylistFilter("1-3,8- last 5")
+	var got []int
+	for pos := 1; pos <= 10; pos++ {
+		if f.matchPosition(pos, 10) {
+			got = append(got, pos)
+		}
+	}
+	if sprintf("%v", got) != "[8 9 10]" {
+		t.Errorf("matchPosition = %v, want [8 9 10]", got)
+	}
+	f, _ = parsePlaylistFilter("since 2024-01-01 until 2024-01-31 max 8m min 1m skip live skip shorts skip blocked")
+	region = "DE"
+	defer func() { region = "" }()
+	published, _ := time.Parse(time.RFC3339, "2024-01-31T23:00:00Z")
+	ok := VideoMeta{Published: published, Duration: 5 * time.Minute, Live: "none"}
+	for _, tt := range []struct {
+		change func(v *VideoMeta)
+		want   string
+	}{
+		{func(v *VideoMeta) {}, ""},
+		{func(v *VideoMeta) { v.Published = published.AddDate(0, -1, 0) }, "filter: published before 2024-01-01"},
+		{func(v *VideoMeta) { v.Published = published.Add(2 * time.Hour) }, "filter: published after 2024-01-31"},
+		{func(v *VideoMeta) { v.Duration = 9 * time.Minute }, "filter: longer than 8:00"},
+		{func(v *VideoMeta) { v.Duration = 30 * time.Second }, "filter: shorter than 1:00"},
+		{func(v *VideoMeta) { v.Live = "upcoming"; v.Duration = 0 }, "filter: upcoming"},
+		{func(v *VideoMeta) { v.Shorts = true }, "filter: shorts"},
+		{func(v *VideoMeta) { v.Blocked = []string{"DE", "FR"} }, "filter: blocked in DE"},
+		{func(v *VideoMeta) { v.Allowed = []string{"US"} }, "filter: blocked in DE"},
+		{func(v *VideoMeta) { v.Allowed = []string{"US", "DE"} }, ""},
+	} {
+		v := ok
+		tt.change(&v)
+		if got := f.matchVideo(v); got != tt.want {
+			t.Errorf("matchVideo(%+v) = %q, want %q", v, got, tt.want)
+		}
+	}
+}
+
+func Test_PlaylistFilter_lastPosition(t *testing.T) {
+	for text, want := range map[string]int{
+		"":                0,
+		"first 10":        10,
+		"1-5,9,12-14":     14,
+		"5 30-":           0,
+		"1-60 first 10":   10,
+		"first 70 1-60":   60,
+		"last 5 max 8m":   0,
+		"first 3 30- 1-2": 3,
+	} {
+		f, _ := parsePlaylistFilter(text)
+		if got := f.lastPosition(); got != want {
+			t.Errorf("lastPosition(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func Test_isShorts(t *testing.T) {
+	for _, tt := range []struct {
+		d     time.Duration
+		title string
+		tags  []string
+		want  bool
+	}{
+		{45 * time.Second, "song", nil, true},
+		{2 * time.Minute, "song #Shorts", nil, true},
+		{2 * time.Minute, "song", []string{"music", "#shorts"}, true},
+		{2 * time.Minute, "song", nil, false},
+		{5 * time.Minute, "song #shorts", nil, false},
+		{0, "live", nil, false},
+	} {
+		if got := isShorts(tt.d, tt.title, "", tt.tags); got != tt.want {
+			t.Errorf("isShorts(%v, %q, %v) = %v, want %v", tt.d, tt.title, tt.tags, got, tt.want)
+		}
+	}
+}
+
+func Test_PlaylistFilter_merge(t *testing.T) {
+	def, _ := parsePlaylistFilter("max 15m skip live")
+	link, _ := parsePlaylistFilter("last 5 max 8m skip shorts")
+	want := &PlaylistFilter{Last: 5, Max: 8 * time.Minute, SkipLive: true, SkipShorts: true}
+	if got := link.merge(def); sprintf("%+v", got) != sprintf("%+v", want) {
+		t.Errorf("merge = %+v, want %+v", got, want)
+	}
+	var none *PlaylistFilter
+	if got := none.merge(def); got != def {
+		t.Errorf("nil merge = %+v, want defaults", got)
+	}
+	if def.Last != 0 || def.Max != 15*time.Minute {
+		t.Errorf("merge changed defaults: %+v", def)
+	}
+	if checkDefaultFilter("max 8m skip live") != nil || checkDefaultFilter("1-10") == nil || checkDefaultFilter("last 3") == nil {
+		t.Errorf("checkDefaultFilter must accept only video filters")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// AudioFormat - output format of audio conversion
+type AudioFormat struct {
+	Name  string
+	Title string
+	Ext   string
+	Copy  string   // source codec which is remuxed without re-encoding
+	Args  []string // ffmpeg encoder args, if source codec is other
+	Audio bool     // telegram plays it as audio (sendAudio), other formats send as document
+	Itag  int      // source itag which allow remux, 0 - any
+}
+
+// audioFormats - variants in quality menu. First is default
+var audioFormats = []AudioFormat{
+	{Name: "mp3_128", Title: "MP3 128", Ext: mp3, Args: []string{"-c:a", "libmp3lame", "-b:a", "128k"}, Audio: true},
+	{Name: "mp3_192", Title: "MP3 192", Ext: mp3, Args: []string{"-c:a", "libmp3lame", "-b:a", "192k"}, Audio: true},
+	{Name: "mp3_320", Title: "MP3 320", Ext: mp3, Args: []string{"-c:a", "libmp3lame", "-b:a", "320k"}, Audio: true},
+	{Name: "mp3_v0", Title: "MP3 VBR V0", Ext: mp3, Args: []string{"-c:a", "libmp3lame", "-q:a", "0"}, Audio: true},
+	{Name: "mp3_v2", Title: "MP3 VBR V2", Ext: mp3, Args: []string{"-c:a", "libmp3lame", "-q:a", "2"}, Audio: true},
+	{Name: "m4a", Title: "M4A (AAC)", Ext: m4a, Copy: "aac", Args: []string{"-c:a", "aac", "-b:a", "192k"}, Audio: true, Itag: 140},
+	{Name: "opus", Title: "OGG (Opus)", Ext: ogg, Copy: "opus", Args: []string{"-c:a", "libopus", "-b:a", "160k"}, Itag: 251},
+	{Name: "flac", Title: "FLAC", Ext: flac, Args: []string{"-c:a", "flac"}},
+}
+
+// findAudioFormat(string) AudioFormat
+// format by name, default if not found
+func findAudioFormat(name string) AudioFormat {
+	for _, v := range audioFormats {
+		if v.Name == name {
+			return v
+		}
+	}
+	return audioFormats[0]
+}
+
+// audioFormat() AudioFormat
+// output format chosen by user
+func (o *botUser) audioFormat() AudioFormat {
+	return findAudioFormat(o.getParameter(paramParam, paramFormat))
+}
+
+// isAudioExt(string) bool
+// extension of converted audio file
+func isAudioExt(ext string) bool {
+	for _, v := range audioFormats {
+		if strings.EqualFold(v.Ext, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAudioItag(string) bool
+// itag of audio only stream
+func isAudioItag(itag string) bool {
+	switch itag {
+	case "251", "250", "249", "140", "139":
+		return true
+	}
+	return false
+}
+
+// itagBitrates - average bitrate (bit/s) of itags from quality menu, used for size estimation
+var itagBitrates = map[string]int64{
+	"251": 135000,
+	"250": 70000,
+	"249": 55000,
+	"140": 130000,
+	"139": 49000,
+	"22":  1500000,
+	"18":  500000,
+	// adaptive video modes, video and audio streams
+	"480":  1100000,
+	"720":  2600000,
+	"1080": 4600000,
+	"1440": 9100000,
+}
+
+// estimateSize(time.Duration, string) int64
+// approximate download size, 0 if itag is unknown
+func estimateSize(d time.Duration, itag string) int64 {
+	return int64(d.Seconds() * float64(itagBitrates[itag]) / 8)
+}
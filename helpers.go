@@ -6,6 +6,7 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -206,3 +207,34 @@ func ssBool(v interface{}) string {
 	}
 	return "-"
 }
+
+// formatDuration(time.Duration) string
+// duration like 3:05 or 1:02:03
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, sec := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return sprintf("%d:%02d", m, sec)
+}
+
+// parseISODuration(string) time.Duration
+// YouTube duration in ISO 8601 format like 'PT1H2M3S' or 'P1DT5M'
+func parseISODuration(val string) time.Duration {
+	re := regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	m := re.FindStringSubmatch(strings.TrimSpace(val))
+	if m == nil {
+		return 0
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var ret time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(m[i+1], 64)
+		ret += time.Duration(n * float64(unit))
+	}
+	return ret
+}
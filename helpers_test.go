@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseISODuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"PT3M25S":   3*time.Minute + 25*time.Second,
+		"PT1H":      time.Hour,
+		"P1DT2H3M":  26*time.Hour + 3*time.Minute,
+		"PT0S":      0,
+		"PT10.5S":   10500 * time.Millisecond,
+		"P0D":       0,
+		"":          0,
+		"5 minutes": 0,
+	} {
+		if got := parseISODuration(in); got != want {
+			t.Errorf("parseISODuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	for in, want := range map[time.Duration]string{
+		0:                             "0:00",
+		3*time.Minute + 5*time.Second: "3:05",
+		time.Hour + 2*time.Minute + 3*time.Second: "1:02:03",
+		1500 * time.Millisecond:                   "0:02",
+	} {
+		if got := formatDuration(in); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Frames - text frames of ID3v2.4 for keys of trackTags, other keys are TXXX
+var id3Frames = map[string]string{
+	"title":        "TIT2",
+	"artist":       "TPE1",
+	"album":        "TALB",
+	"album_artist": "TPE2",
+	"date":         "TDRC",
+	"genre":        "TCON",
+	"publisher":    "TPUB",
+	"composer":     "TCOM",
+	"track":        "TRCK",
+}
+
+// syncsafe(int) []byte
+// 28 bit number in 4 bytes of 7 bits
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// unsyncsafe([]byte) int
+// number from 4 bytes of 7 bits
+func unsyncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Size([]byte) int
+// size of ID3v2 tag at start of file with header and footer, 0 if file has no tag
+func id3Size(data []byte) int {
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("ID3")) {
+		return 0
+	}
+	size := unsyncsafe(data[6:10]) + 10
+	if data[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return min(size, len(data))
+}
+
+// id3Frame(string, ...[]byte) []byte
+// frame of ID3v2.4 with body from parts
+func id3Frame(id string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	ret := append([]byte(id), syncsafe(len(body))...)
+	ret = append(ret, 0, 0)
+	return append(ret, body...)
+}
+
+// writeID3([]byte, map[string]string, []byte) ([]byte, error)
+// file with new ID3v2.4 tag (UTF-8 text) instead of old one
+func writeID3(data []byte, tags map[string]string, cover []byte) ([]byte, error) {
+	var frames bytes.Buffer
+	utf8 := []byte{3}
+	for _, k := range sortedKeys(tags) {
+		val := []byte(tags[k])
+		switch id, ok := id3Frames[k]; {
+		case ok:
+			frames.Write(id3Frame(id, utf8, val))
+		case k == "comment":
+			frames.Write(id3Frame("COMM", utf8, []byte("eng\x00"), val))
+		default:
+			frames.Write(id3Frame("TXXX", utf8, []byte(k), []byte{0}, val))
+		}
+	}
+	if len(cover) > 0 {
+		// picture type 3 - front cover, empty description
+		frames.Write(id3Frame("APIC", utf8, []byte(coverMime(cover)), []byte{0, 3, 0}, cover))
+	}
+	if frames.Len() >= 1<<28 {
+		return nil, errors.New("ID3 tag is too big")
+	}
+	ret := append([]byte("ID3\x04\x00\x00"), syncsafe(frames.Len())...)
+	ret = append(ret, frames.Bytes()...)
+	return append(ret, data[id3Size(data):]...), nil
+}
+
+// decodeID3Text(byte, []byte) string
+// text of frame in encoding: 0 - ISO-8859-1, 1 - UTF-16 with BOM, 2 - UTF-16BE, 3 - UTF-8
+func decodeID3Text(enc byte, b []byte) string {
+	var s string
+	switch enc {
+	case 0:
+		r := make([]rune, len(b))
+		for k, c := range b {
+			r[k] = rune(c)
+		}
+		s = string(r)
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			if (b[0] == 0xff && b[1] == 0xfe) || (b[0] == 0xfe && b[1] == 0xff) {
+				b = b[2:]
+			}
+		}
+		u := make([]uint16, len(b)/2)
+		for k := range u {
+			u[k] = order.Uint16(b[2*k:])
+		}
+		s = string(utf16.Decode(u))
+	default:
+		s = string(b)
+	}
+	// ID3v2.4 separates values by null
+	return strings.ReplaceAll(strings.TrimRight(s, "\x00"), "\x00", "; ")
+}
+
+// cutID3String(byte, []byte) (string, []byte)
+// null terminated string in encoding and rest of body
+func cutID3String(enc byte, b []byte) (string, []byte) {
+	if enc == 1 || enc == 2 {
+		for k := 0; k+1 < len(b); k += 2 {
+			if b[k] == 0 && b[k+1] == 0 {
+				return decodeID3Text(enc, b[:k]), b[k+2:]
+			}
+		}
+		return decodeID3Text(enc, b), nil
+	}
+	if k := bytes.IndexByte(b, 0); k >= 0 {
+		return decodeID3Text(enc, b[:k]), b[k+1:]
+	}
+	return decodeID3Text(enc, b), nil
+}
+
+// readID3([]byte) (map[string]string, []byte, error)
+// tags of ID3v2.3 or ID3v2.4 in keys of trackTags and front cover
+func readID3(data []byte) (map[string]string, []byte, error) {
+	tags := make(map[string]string)
+	size := id3Size(data)
+	if size == 0 {
+		return tags, nil, nil
+	}
+	version := data[3]
+	if version != 3 && version != 4 {
+		return nil, nil, errors.New("unsupported ID3v2 version")
+	}
+	if data[5]&0x80 != 0 {
+		return nil, nil, errors.New("unsynchronised ID3v2 tag is not supported")
+	}
+	names := make(map[string]string)
+	for k, id := range id3Frames {
+		names[id] = k
+	}
+	names["TYER"] = "date"
+	pos := 10
+	if data[5]&0x40 != 0 && pos+4 <= size {
+		// extended header
+		if version == 4 {
+			pos += unsyncsafe(data[pos : pos+4])
+		} else {
+			pos += int(binary.BigEndian.Uint32(data[pos:])) + 4
+		}
+	}
+	var cover []byte
+	for pos+10 <= size && data[pos] != 0 {
+		id := string(data[pos : pos+4])
+		n := int(binary.BigEndian.Uint32(data[pos+4:]))
+		if version == 4 {
+			n = unsyncsafe(data[pos+4 : pos+8])
+		}
+		end := min(pos+10+n, size)
+		body := data[pos+10 : end]
+		pos = end
+		if len(body) == 0 {
+			continue
+		}
+		enc := body[0]
+		switch {
+		case id == "TXXX":
+			desc, rest := cutID3String(enc, body[1:])
+			tags[desc] = decodeID3Text(enc, rest)
+		case id == "COMM" && len(body) > 4:
+			_, rest := cutID3String(enc, body[4:])
+			tags["comment"] = decodeID3Text(enc, rest)
+		case id == "APIC":
+			_, rest := cutID3String(0, body[1:]) // mime is ISO-8859-1
+			if len(rest) == 0 {
+				continue
+			}
+			kind := rest[0]
+			_, picture := cutID3String(enc, rest[1:])
+			if cover == nil || kind == 3 {
+				cover = picture
+			}
+		case names[id] != "":
+			tags[names[id]] = decodeID3Text(enc, body[1:])
+		}
+	}
+	return tags, cover, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	paramLoudness   = "loudness"
+	loudnessOff     = "off"
+	loudnessNorm    = "normalize"
+	loudnessGain    = "replaygain"
+	commandLoudness = "!!!loudness!!!"
+	// replayGainReference - loudness of ReplayGain 2.0 reference, LUFS
+	replayGainReference = -18.0
+	// loudnormTP, loudnormLRA - true peak (dBTP) and loudness range (LU) of normalization
+	loudnormTP  = -1.5
+	loudnormLRA = 11.0
+)
+
+// loudnessModes - variants of loudness setting, off is default
+var loudnessModes = []string{loudnessOff, loudnessNorm, loudnessGain}
+
+// loudnessTitles - names of modes in settings menu
+var loudnessTitles = map[string]string{
+	loudnessOff:  "🔈 as is",
+	loudnessNorm: "🔊 normalize (EBU R128)",
+	loudnessGain: "🏷 ReplayGain tags",
+}
+
+// loudnessTarget - integrated loudness of normalization, LUFS, env LOUDNESS_TARGET
+var loudnessTarget = -16.0
+
+// Loudness - EBU R128 measurement of first loudnorm pass
+type Loudness struct {
+	Input     float64 // integrated loudness, LUFS
+	TruePeak  float64 // dBTP
+	LRA       float64 // loudness range, LU
+	Threshold float64
+	Offset    float64
+}
+
+// loudnessMode() string
+// loudness mode chosen by user
+func (o *botUser) loudnessMode() string {
+	mode := o.getParameter(paramParam, paramLoudness)
+	if !slices.Contains(loudnessModes, mode) {
+		return loudnessOff
+	}
+	return mode
+}
+
+// parseLoudnessTarget(string) float64
+// target loudness from env, default if empty or out of loudnorm range
+func parseLoudnessTarget(val string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil || f < -70 || f > -5 {
+		return loudnessTarget
+	}
+	return f
+}
+
+// parseLoudnorm(string) (*Loudness, error)
+// json block of loudnorm from ffmpeg output
+func parseLoudnorm(out string) (*Loudness, error) {
+	from, to := strings.LastIndex(out, "{"), strings.LastIndex(out, "}")
+	if from < 0 || to < from {
+		return nil, errors.New("no loudnorm result")
+	}
+	var raw struct {
+		Input     string `json:"input_i"`
+		TruePeak  string `json:"input_tp"`
+		LRA       string `json:"input_lra"`
+		Threshold string `json:"input_thresh"`
+		Offset    string `json:"target_offset"`
+	}
+	if err := json.Unmarshal([]byte(out[from:to+1]), &raw); err != nil {
+		return nil, err
+	}
+	ret := new(Loudness)
+	for _, f := range []struct {
+		dst *float64
+		val string
+	}{{&ret.Input, raw.Input}, {&ret.TruePeak, raw.TruePeak}, {&ret.LRA, raw.LRA}, {&ret.Threshold, raw.Threshold}, {&ret.Offset, raw.Offset}} {
+		n, err := strconv.ParseFloat(f.val, 64)
+		if err != nil {
+			return nil, errors.New("wrong loudnorm value " + f.val)
+		}
+		*f.dst = n
+	}
+	if math.IsInf(ret.Input, 0) {
+		return nil, errors.New("silent audio")
+	}
+	return ret, nil
+}
+
+// measureLoudness(string) (*Loudness, error)
+// first pass of loudnorm, file is not changed
+func measureLoudness(src string) (*Loudness, error) {
+	var args []string
+	args = append(args, "-hide_banner")
+	args = append(args, "-nostats")
+	args = append(args, "-i")
+	args = append(args, src)
+	args = append(args, "-map")
+	args = append(args, "0:a:0")
+	args = append(args, "-af")
+	args = append(args, sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f:print_format=json", loudnessTarget, loudnormTP, loudnormLRA))
+	args = append(args, "-f")
+	args = append(args, "null")
+	args = append(args, "-")
+	out, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return nil, errors.New("ffmpeg loudnorm: " + err.Error())
+	}
+	return parseLoudnorm(string(out))
+}
+
+// measureAlbum([]string) (*Loudness, error)
+// first pass of loudnorm over files played one after another
+func measureAlbum(files []string) (*Loudness, error) {
+	var args []string
+	args = append(args, "-hide_banner")
+	args = append(args, "-nostats")
+	inputs := ""
+	for k, v := range files {
+		args = append(args, "-i")
+		args = append(args, v)
+		inputs += sprintf("[%d:a:0]", k)
+	}
+	args = append(args, "-filter_complex")
+	args = append(args, sprintf("%sconcat=n=%d:v=0:a=1,loudnorm=I=%.1f:TP=%.1f:LRA=%.1f:print_format=json", inputs, len(files), loudnessTarget, loudnormTP, loudnormLRA))
+	args = append(args, "-f")
+	args = append(args, "null")
+	args = append(args, "-")
+	out, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return nil, errors.New("ffmpeg loudnorm: " + err.Error())
+	}
+	return parseLoudnorm(string(out))
+}
+
+// loudnormFilter(*Loudness) string
+// second pass of loudnorm with measured values, linear mode keeps dynamics
+func loudnormFilter(l *Loudness) string {
+	return sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f:measured_I=%.2f:measured_TP=%.2f:measured_LRA=%.2f:measured_thresh=%.2f:offset=%.2f:linear=true",
+		loudnessTarget, loudnormTP, loudnormLRA, l.Input, l.TruePeak, l.LRA, l.Threshold, l.Offset)
+}
+
+// replayGain() (float64, float64)
+// gain (dB) to ReplayGain reference and linear peak
+func (l *Loudness) replayGain() (float64, float64) {
+	return replayGainReference - l.Input, math.Pow(10, l.TruePeak/20)
+}
+
+// replayGainTags(*Loudness, *Loudness) map[string]string
+// ReplayGain 2.0 tags of track, album tags only if album is measured
+func replayGainTags(track, album *Loudness) map[string]string {
+	ret := make(map[string]string)
+	gain, peak := track.replayGain()
+	ret["REPLAYGAIN_TRACK_GAIN"] = sprintf("%.2f dB", gain)
+	ret["REPLAYGAIN_TRACK_PEAK"] = sprintf("%.6f", peak)
+	if album != nil {
+		for k, v := range albumGainTags(album) {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// albumGainTags(*Loudness) map[string]string
+// ReplayGain 2.0 album tags
+func albumGainTags(album *Loudness) map[string]string {
+	gain, peak := album.replayGain()
+	return map[string]string{
+		"REPLAYGAIN_ALBUM_GAIN": sprintf("%.2f dB", gain),
+		"REPLAYGAIN_ALBUM_PEAK": sprintf("%.6f", peak),
+	}
+}
+
+// FfprobeSampleRate(string) string
+// sample rate of first audio stream, empty if unknown
+func FfprobeSampleRate(url string) string {
+	var args []string
+	args = append(args, "-v")
+	args = append(args, "error")
+	args = append(args, "-select_streams")
+	args = append(args, "a:0")
+	args = append(args, "-show_entries")
+	args = append(args, "stream=sample_rate")
+	args = append(args, "-of")
+	args = append(args, "default=noprint_wrappers=1:nokey=1")
+	args = append(args, url)
+	rate, _ := exec.Command("ffprobe", args...).Output()
+	return strings.TrimSpace(string(rate))
+}
+
+// measureSource(*JsonPls, string)
+// normalize mode: loudness of downloaded video, audio is normalized by conversion in the same encoding
+func measureSource(v *JsonPls, mode string) {
+	if mode != loudnessNorm {
+		return
+	}
+	l, err := measureLoudness(v.URLSaved + mp4)
+	if err != nil {
+		v.toLog("loudness: "+err.Error(), true)
+		return
+	}
+	v.Loudnorm = l
+}
+
+// normalizeArgs(*JsonPls, AudioFormat) []string
+// ffmpeg args of loudnorm second pass for conversion
+func normalizeArgs(v *JsonPls, format AudioFormat) []string {
+	var args []string
+	args = append(args, "-af")
+	args = append(args, loudnormFilter(v.Loudnorm))
+	// loudnorm works at 192 kHz, keep rate of source. Opus has only 48 kHz of common rates
+	rate := FfprobeSampleRate(v.URLSaved + mp4)
+	if format.Ext == ogg {
+		rate = "48000"
+	}
+	if rate != "" {
+		args = append(args, "-ar")
+		args = append(args, rate)
+	}
+	return args
+}
+
+// applyReplayGain(*JsonPls, AudioFormat, *Loudness) (*Loudness, error)
+// write ReplayGain tags of converted audio (without ffmpeg), album - measurement of whole album for album gain
+func applyReplayGain(v *JsonPls, format AudioFormat, album *Loudness) (*Loudness, error) {
+	defer new(Timer).Start().Stop()
+	src := v.URLSaved + format.Ext
+	l, err := measureLoudness(src)
+	if err != nil {
+		return nil, err
+	}
+	// tags are written in place, audio is not touched
+	if err := updateFileTags(src, replayGainTags(l, album)); err != nil {
+		return nil, err
+	}
+	gain, _ := l.replayGain()
+	v.Loudness = sprintf("%.1f LUFS, gain %+.2f dB", l.Input, gain)
+	v.toLog("loudness: " + v.Loudness)
+	return l, nil
+}
+
+// partsGain(*JsonPls, AudioFormat, *Loudness)
+// ReplayGain tags of chapters, whole video is album
+func partsGain(v *JsonPls, format AudioFormat, album *Loudness) {
+	for _, part := range v.Parts {
+		if _, err := applyReplayGain(part, format, album); err != nil {
+			part.toLog("loudness: "+err.Error(), true)
+		}
+	}
+}
+
+// albumGain([]*JsonPls, AudioFormat)
+// ReplayGain album tags of converted playlist tracks, album is measured over all of them
+func albumGain(tracks []*JsonPls, format AudioFormat) {
+	defer new(Timer).Start().Stop()
+	var files []string
+	for _, v := range tracks {
+		files = append(files, v.URLSaved+format.Ext)
+	}
+	album, err := measureAlbum(files)
+	if err != nil {
+		toLog("album loudness: " + err.Error())
+		return
+	}
+	tags := albumGainTags(album)
+	for _, v := range tracks {
+		if err := updateFileTags(v.URLSaved+format.Ext, tags); err != nil {
+			v.toLog("album loudness: "+err.Error(), true)
+		}
+	}
+}
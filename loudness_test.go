@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseLoudnorm(t *testing.T) {
+	out := `[Parsed_loudnorm_0 @ 0x55d]
+{
+	"input_i" : "-9.84",
+	"input_tp" : "0.52",
+	"input_lra" : "5.10",
+	"input_thresh" : "-20.02",
+	"output_i" : "-16.02",
+	"output_tp" : "-1.50",
+	"output_lra" : "4.20",
+	"output_thresh" : "-26.10",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.02"
+}
+`
+	l, err := parseLoudnorm(out)
+	if err != nil {
+		t.Fatalf("parseLoudnorm() error = %v", err)
+	}
+	if l.Input != -9.84 || l.TruePeak != 0.52 || l.LRA != 5.1 || l.Threshold != -20.02 || l.Offset != 0.02 {
+		t.Errorf("parseLoudnorm() = %+v", l)
+	}
+	if got := loudnormFilter(l); got != "loudnorm=I=-16.0:TP=-1.5:LRA=11.0:measured_I=-9.84:measured_TP=0.52:measured_LRA=5.10:measured_thresh=-20.02:offset=0.02:linear=true" {
+		t.Errorf("loudnormFilter() = %s", got)
+	}
+	for _, bad := range []string{"", "no json", `{"input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00", "input_thresh" : "-70.00", "target_offset" : "0.00"}`} {
+		if _, err := parseLoudnorm(bad); err == nil {
+			t.Errorf("parseLoudnorm(%q) error = nil", bad)
+		}
+	}
+}
+
+func Test_replayGainTags(t *testing.T) {
+	track := &Loudness{Input: -9.84, TruePeak: 0}
+	album := &Loudness{Input: -12, TruePeak: -6.0206}
+	tags := replayGainTags(track, nil)
+	if tags["REPLAYGAIN_TRACK_GAIN"] != "-8.16 dB" || tags["REPLAYGAIN_TRACK_PEAK"] != "1.000000" || len(tags) != 2 {
+		t.Errorf("replayGainTags(track) = %v", tags)
+	}
+	tags = replayGainTags(track, album)
+	if tags["REPLAYGAIN_ALBUM_GAIN"] != "-6.00 dB" || tags["REPLAYGAIN_ALBUM_PEAK"] != "0.500000" {
+		t.Errorf("replayGainTags(album) = %v", tags)
+	}
+	for val, want := range map[string]float64{"": -16, "-23": -23, "-100": -16, "loud": -16} {
+		if got := parseLoudnessTarget(val); got != want {
+			t.Errorf("parseLoudnessTarget(%q) = %v, want %v", val, got, want)
+		}
+	}
+}
+
+func Test_albumGain(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found")
+	}
+	dir := t.TempDir()
+	format := findAudioFormat("mp3_128")
+	var tracks []*JsonPls
+	for k, volume := range []string{"0.1", "0.8"} {
+		v := &JsonPls{URLSaved: filepath.Join(dir, sprintf("track%d", k))}
+		if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "sine=duration=2", "-af", "volume="+volume, v.URLSaved+format.Ext).Run(); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, v)
+	}
+	albumGain(tracks, format)
+	var gains []string
+	for _, v := range tracks {
+		tags, _, err := readFileTags(v.URLSaved + format.Ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gains = append(gains, tags["REPLAYGAIN_ALBUM_GAIN"])
+	}
+	if gains[0] == "" || gains[0] != gains[1] {
+		t.Errorf("album gains = %v", gains)
+	}
+}
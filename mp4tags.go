@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	// mp4DataUTF8, mp4DataBinary, mp4DataJPEG, mp4DataPNG - types of 'data' atom
+	mp4DataUTF8   = 1
+	mp4DataBinary = 0
+	mp4DataJPEG   = 13
+	mp4DataPNG    = 14
+	// mp4FreeformMean - namespace of '----' atoms
+	mp4FreeformMean = "com.apple.iTunes"
+)
+
+// mp4Atoms - iTunes atoms for keys of trackTags, other keys are '----' atoms
+var mp4Atoms = map[string]string{
+	"title":        "\xa9nam",
+	"artist":       "\xa9ART",
+	"album":        "\xa9alb",
+	"album_artist": "aART",
+	"date":         "\xa9day",
+	"genre":        "\xa9gen",
+	"publisher":    "\xa9pub",
+	"composer":     "\xa9wrt",
+	"comment":      "\xa9cmt",
+}
+
+// Mp4Atom - atom in file: type and offsets of header, body and end
+type Mp4Atom struct {
+	Type  string
+	Start int
+	Body  int
+	End   int
+}
+
+// mp4Children([]byte, int, int) ([]Mp4Atom, error)
+// atoms between offsets
+func mp4Children(data []byte, from, to int) ([]Mp4Atom, error) {
+	var ret []Mp4Atom
+	for pos := from; pos < to; {
+		if pos+8 > to {
+			return nil, errors.New("wrong MP4 atom")
+		}
+		a := Mp4Atom{Type: string(data[pos+4 : pos+8]), Start: pos, Body: pos + 8}
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		switch size {
+		case 0:
+			size = to - pos // till the end
+		case 1:
+			if pos+16 > to {
+				return nil, errors.New("wrong MP4 atom")
+			}
+			size = int(binary.BigEndian.Uint64(data[pos+8:]))
+			a.Body += 8
+		}
+		a.End = pos + size
+		if size < a.Body-pos || a.End > to {
+			return nil, errors.New("wrong MP4 atom " + a.Type)
+		}
+		ret = append(ret, a)
+		pos = a.End
+	}
+	return ret, nil
+}
+
+// mp4Find([]Mp4Atom, string) (Mp4Atom, bool)
+// first atom of type
+func mp4Find(atoms []Mp4Atom, typ string) (Mp4Atom, bool) {
+	for _, a := range atoms {
+		if a.Type == typ {
+			return a, true
+		}
+	}
+	return Mp4Atom{}, false
+}
+
+// mp4Box(string, ...[]byte) []byte
+// atom with body from parts
+func mp4Box(typ string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	ret := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	ret = append(ret, typ...)
+	return append(ret, body...)
+}
+
+// mp4Data(uint32, []byte) []byte
+// 'data' atom with type and empty locale
+func mp4Data(kind uint32, value []byte) []byte {
+	return mp4Box("data", binary.BigEndian.AppendUint32(nil, kind), []byte{0, 0, 0, 0}, value)
+}
+
+// mp4Ilst(map[string]string, []byte) []byte
+// 'ilst' atom with tags and cover
+func mp4Ilst(tags map[string]string, cover []byte) []byte {
+	var items [][]byte
+	for _, k := range sortedKeys(tags) {
+		val := []byte(tags[k])
+		switch atom, ok := mp4Atoms[k]; {
+		case ok:
+			items = append(items, mp4Box(atom, mp4Data(mp4DataUTF8, val)))
+		case k == "track":
+			track, total := splitTrack(tags[k])
+			trkn := []byte{0, 0, byte(track >> 8), byte(track), byte(total >> 8), byte(total), 0, 0}
+			items = append(items, mp4Box("trkn", mp4Data(mp4DataBinary, trkn)))
+		default:
+			items = append(items, mp4Box("----",
+				mp4Box("mean", []byte{0, 0, 0, 0}, []byte(mp4FreeformMean)),
+				mp4Box("name", []byte{0, 0, 0, 0}, []byte(k)),
+				mp4Data(mp4DataUTF8, val)))
+		}
+	}
+	if len(cover) > 0 {
+		kind := uint32(mp4DataJPEG)
+		if coverMime(cover) == "image/png" {
+			kind = mp4DataPNG
+		}
+		items = append(items, mp4Box("covr", mp4Data(kind, cover)))
+	}
+	return mp4Box("ilst", items...)
+}
+
+// mp4Meta(map[string]string, []byte) []byte
+// 'meta' atom of iTunes with handler 'mdir'
+func mp4Meta(tags map[string]string, cover []byte) []byte {
+	hdlr := mp4Box("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9))
+	return mp4Box("meta", []byte{0, 0, 0, 0}, hdlr, mp4Ilst(tags, cover))
+}
+
+// shiftChunkOffsets([]byte, int, int) error
+// add delta to chunk offsets (stco, co64) of all tracks which are not less than limit, moov is changed in place
+func shiftChunkOffsets(moov []byte, limit, delta int) error {
+	var walk func(from, to int) error
+	walk = func(from, to int) error {
+		atoms, err := mp4Children(moov, from, to)
+		if err != nil {
+			return err
+		}
+		for _, a := range atoms {
+			switch {
+			case a.Type == "trak" || a.Type == "mdia" || a.Type == "minf" || a.Type == "stbl":
+				if err := walk(a.Body, a.End); err != nil {
+					return err
+				}
+			case a.Type == "stco" || a.Type == "co64":
+				if a.Body+8 > a.End {
+					return errors.New("wrong " + a.Type)
+				}
+				count := int(binary.BigEndian.Uint32(moov[a.Body+4:]))
+				size := 4
+				if a.Type == "co64" {
+					size = 8
+				}
+				if a.Body+8+count*size > a.End {
+					return errors.New("wrong " + a.Type)
+				}
+				for k := 0; k < count; k++ {
+					pos := a.Body + 8 + k*size
+					if size == 4 {
+						offset := int(binary.BigEndian.Uint32(moov[pos:]))
+						if offset >= limit {
+							if offset+delta >= 1<<32 {
+								return errors.New("chunk offset is too big for stco")
+							}
+							binary.BigEndian.PutUint32(moov[pos:], uint32(offset+delta))
+						}
+					} else if offset := int(binary.BigEndian.Uint64(moov[pos:])); offset >= limit {
+						binary.BigEndian.PutUint64(moov[pos:], uint64(offset+delta))
+					}
+				}
+			}
+		}
+		return nil
+	}
+	atoms, err := mp4Children(moov, 0, len(moov))
+	if err != nil || len(atoms) != 1 {
+		return errors.New("wrong moov")
+	}
+	return walk(atoms[0].Body, atoms[0].End)
+}
+
+// writeMP4Tags([]byte, map[string]string, []byte) ([]byte, error)
+// MP4 with new 'meta' in moov/udta, chunk offsets are moved if moov is before media data
+func writeMP4Tags(data []byte, tags map[string]string, cover []byte) ([]byte, error) {
+	top, err := mp4Children(data, 0, len(data))
+	if err != nil {
+		return nil, err
+	}
+	moov, ok := mp4Find(top, "moov")
+	if !ok {
+		return nil, errors.New("MP4 without moov")
+	}
+	children, err := mp4Children(data, moov.Body, moov.End)
+	if err != nil {
+		return nil, err
+	}
+	var parts [][]byte
+	udta := [][]byte{mp4Meta(tags, cover)}
+	for _, a := range children {
+		if a.Type != "udta" {
+			parts = append(parts, data[a.Start:a.End])
+			continue
+		}
+		inner, err := mp4Children(data, a.Body, a.End)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range inner {
+			if u.Type != "meta" {
+				udta = append(udta, data[u.Start:u.End])
+			}
+		}
+	}
+	parts = append(parts, mp4Box("udta", udta...))
+	newMoov := mp4Box("moov", parts...)
+	if delta := len(newMoov) - (moov.End - moov.Start); delta != 0 {
+		// media data after moov is moved by delta
+		if err := shiftChunkOffsets(newMoov, moov.End, delta); err != nil {
+			return nil, err
+		}
+	}
+	ret := append([]byte{}, data[:moov.Start]...)
+	ret = append(ret, newMoov...)
+	return append(ret, data[moov.End:]...), nil
+}
+
+// readMP4Tags([]byte) (map[string]string, []byte, error)
+// tags of moov/udta/meta/ilst in keys of trackTags and cover
+func readMP4Tags(data []byte) (map[string]string, []byte, error) {
+	tags := make(map[string]string)
+	top, err := mp4Children(data, 0, len(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	moov, ok := mp4Find(top, "moov")
+	if !ok {
+		return nil, nil, errors.New("MP4 without moov")
+	}
+	path := []string{"udta", "meta", "ilst"}
+	from, to := moov.Body, moov.End
+	for _, name := range path {
+		atoms, err := mp4Children(data, from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		a, ok := mp4Find(atoms, name)
+		if !ok {
+			return tags, nil, nil
+		}
+		from, to = a.Body, a.End
+		if name == "meta" {
+			from += 4 // version and flags
+		}
+	}
+	items, err := mp4Children(data, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make(map[string]string)
+	for k, atom := range mp4Atoms {
+		names[atom] = k
+	}
+	var cover []byte
+	for _, item := range items {
+		inner, err := mp4Children(data, item.Body, item.End)
+		if err != nil {
+			continue
+		}
+		d, ok := mp4Find(inner, "data")
+		if !ok || d.Body+8 > d.End {
+			continue
+		}
+		value := data[d.Body+8 : d.End]
+		switch {
+		case item.Type == "covr":
+			if cover == nil {
+				cover = value
+			}
+		case item.Type == "trkn" && len(value) >= 6:
+			tags["track"] = joinTrack(int(binary.BigEndian.Uint16(value[2:])), int(binary.BigEndian.Uint16(value[4:])))
+		case item.Type == "----":
+			if n, ok := mp4Find(inner, "name"); ok && n.Body+4 <= n.End {
+				tags[strings.ToUpper(string(data[n.Body+4:n.End]))] = string(value)
+			}
+		case names[item.Type] != "":
+			tags[names[item.Type]] = string(value)
+		}
+	}
+	return tags, cover, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TitleRule - user defined regexp replacement, applied to video title before splitting
+type TitleRule struct {
+	Pattern string
+	Replace string
+}
+
+const (
+	paramTitleRules = "title_rules"
+	maxTitleRules   = 20
+)
+
+var (
+	// reDashSplit - "Artist - Title" with hyphen, en dash, em dash, figure dash, horizontal bar
+	reDashSplit = regexp.MustCompile(`\s+[-‐‒–—―]+\s+`)
+	// reBrackets - part of title in brackets
+	reBrackets = regexp.MustCompile(`\s*[(\[【]([^)\]】]*)[)\]】]`)
+	// reNoise - bracket content which is not a part of song name
+	reNoise = regexp.MustCompile(`(?i)^\s*(official(\s+(music|lyrics?|hd))?(\s+(video|audio|visualizer|clip))?|(music|lyrics?)\s+video|video(\s+oficial)?|clip\s+officiel|audio|lyrics?|visualizer|hd|hq|4k|1080p|720p|no\s+copyright(\s+music)?|copyright\s+free(\s+music)?|royalty\s+free(\s+music)?|free\s+download|ncs\s+release|out\s+now)\s*$`)
+	// reNoiseTail - noise without brackets at the end of title
+	reNoiseTail = regexp.MustCompile(`(?i)\s*[|/]\s*(official\s+(music\s+)?video|lyrics?|no\s+copyright\s+music)\s*$`)
+	// reFeat - "feat.", "ft.", "featuring" and variants
+	reFeat = regexp.MustCompile(`(?i)\s*[(\[]?\b(?:feat\.?|ft\.?|featuring)\s+([^)\]]+?)[)\]]?\s*$`)
+	// reFeatBracket - "(feat. X)" in the middle of title
+	reFeatBracket = regexp.MustCompile(`(?i)\s*[(\[]\s*(?:feat\.?|ft\.?|featuring)\s+([^)\]]+)[)\]]`)
+	reSpaces      = regexp.MustCompile(`\s+`)
+	// reChannelNoise - channel name suffixes
+	reChannelNoise = regexp.MustCompile(`(?i)(\s+-\s+topic|vevo|\s+official(\s+channel)?)$`)
+	// reSongFirst - library channels which name videos "Title – Artist"
+	reSongFirst = regexp.MustCompile(`(?i)\baudio\s+library\b`)
+)
+
+// normalizeTrack(string, string, []TitleRule) (string, string)
+// artist and song from channel name and video title
+func normalizeTrack(channel, title string, rules []TitleRule) (string, string) {
+	original := title
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			continue
+		}
+		title = re.ReplaceAllString(title, r.Replace)
+	}
+	title = reBrackets.ReplaceAllStringFunc(title, func(s string) string {
+		if reNoise.MatchString(reBrackets.FindStringSubmatch(s)[1]) {
+			return ""
+		}
+		return s
+	})
+	title = reNoiseTail.ReplaceAllString(title, "")
+	var feat []string
+	title = reFeatBracket.ReplaceAllStringFunc(title, func(s string) string {
+		feat = append(feat, strings.TrimSpace(reFeatBracket.FindStringSubmatch(s)[1]))
+		return ""
+	})
+	artist := strings.TrimSpace(reChannelNoise.ReplaceAllString(strings.TrimSpace(channel), ""))
+	song := title
+	if parts := reDashSplit.Split(title, 2); len(parts) == 2 && strings.TrimSpace(parts[0]) != "" && strings.TrimSpace(parts[1]) != "" {
+		artist, song = parts[0], parts[1]
+		if reSongFirst.MatchString(channel) {
+			artist, song = song, artist
+		}
+	}
+	split := func(s string) (string, string) {
+		if m := reFeat.FindStringSubmatchIndex(s); m != nil {
+			return s[:m[0]], strings.TrimSpace(s[m[2]:m[3]])
+		}
+		return s, ""
+	}
+	var f string
+	if artist, f = split(artist); f != "" {
+		feat = append([]string{f}, feat...)
+	}
+	if song, f = split(song); f != "" {
+		feat = append(feat, f)
+	}
+	clean := func(s string) string {
+		return strings.Trim(reSpaces.ReplaceAllString(s, " "), " -|")
+	}
+	artist, song = clean(artist), clean(song)
+	if len(feat) > 0 {
+		artist += " feat. " + strings.Join(feat, ", ")
+	}
+	if song == "" {
+		song = clean(original)
+	}
+	return artist, song
+}
+
+// titleRules() []TitleRule
+// user defined rules from database
+func (o *botUser) titleRules() []TitleRule {
+	var rules []TitleRule
+	json.Unmarshal([]byte(o.getDbVal(paramTitleRules)), &rules)
+	return rules
+}
+
+// setTitleRules([]TitleRule)
+// save user defined rules
+func (o *botUser) setTitleRules(rules []TitleRule) {
+	data, _ := json.Marshal(rules)
+	o.Db.FindCreate(o.Sid).Put(paramTitleRules, string(data))
+}
+
+// parseTitleRule(string) (TitleRule, error)
+// rule from text "pattern => replacement"
+func parseTitleRule(text string) (TitleRule, error) {
+	pattern, replace, _ := strings.Cut(text, "=>")
+	rule := TitleRule{Pattern: strings.TrimSpace(pattern), Replace: strings.TrimSpace(replace)}
+	_, err := regexp.Compile(rule.Pattern)
+	if err == nil && rule.Pattern == "" {
+		err = errors.New("empty pattern")
+	}
+	return rule, err
+}
+
+// addTitleRuleCommands(*Commands, *Tasker)
+// command 'rules' for user defined title rules
+func (obj *Action) addTitleRuleCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandRules, "✏rules", false, false, func(message Message, usr *botUser) {
+		rules := usr.titleRules()
+		arg := commandArgument(message, commandRules)
+		action, rest, _ := strings.Cut(arg, " ")
+		message.DelBefore = true
+		switch strings.ToLower(action) {
+		case "add":
+			rule, err := parseTitleRule(rest)
+			switch {
+			case err != nil:
+				message.Text = infoLabel + message.tr("Wrong rule") + ": " + html.EscapeString(err.Error())
+			case len(rules) >= maxTitleRules:
+				message.Text = infoLabel + message.tr("Too many rules") + sprintf(": %d", maxTitleRules)
+			default:
+				usr.setTitleRules(append(rules, rule))
+				message.Text = message.tr("Rule added")
+			}
+		case "del":
+			n, err := strconv.Atoi(strings.TrimSpace(rest))
+			if err != nil || n < 1 || n > len(rules) {
+				message.Text = infoLabel + message.tr("Wrong rule number")
+				break
+			}
+			usr.setTitleRules(append(rules[:n-1], rules[n:]...))
+			message.Text = message.tr("Rule deleted")
+		case "clear":
+			usr.setTitleRules(nil)
+			message.Text = message.tr("Rules deleted")
+		default:
+			message.Text = "<b>" + message.tr("Title rules") + "</b>\n"
+			for i, r := range rules {
+				message.Text += sprintf("%d) <code>%s</code> => <code>%s</code>\n", i+1, html.EscapeString(r.Pattern), html.EscapeString(r.Replace))
+			}
+			if len(rules) == 0 {
+				message.Text += message.tr("No rules") + "\n"
+			}
+			message.Text += "\n<code>/" + commandRules + " add (.+) – (.+) => $2 - $1</code>\n" +
+				"<code>/" + commandRules + " del 1</code>\n" +
+				"<code>/" + commandRules + " clear</code>\n" +
+				message.tr("Rules are regular expressions applied to video title before splitting 'Artist - Title'.")
+		}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func Test_normalizeTrack(t *testing.T) {
+	swap := []TitleRule{{Pattern: `^(.+?) – (.+?)( \(.*\))?$`, Replace: "$2 - $1$3"}}
+	tests := []struct {
+		name, channel, title string
+		rules                []TitleRule
+		artist, song         string
+	}{
+		{"plain title", "Some Band", "Song Name", nil, "Some Band", "Song Name"},
+		{"hyphen split", "Label Channel", "Artist - Song", nil, "Artist", "Song"},
+		{"en dash split", "Label Channel", "Artist – Song", nil, "Artist", "Song"},
+		{"em dash split", "Label Channel", "Artist — Song", nil, "Artist", "Song"},
+		{"hyphen in word", "Jay-Z", "Run-This-Town", nil, "Jay-Z", "Run-This-Town"},
+		{"official video", "Artist", "Artist - Song (Official Video)", nil, "Artist", "Song"},
+		{"official music video brackets", "ArtistVEVO", "Artist - Song [Official Music Video]", nil, "Artist", "Song"},
+		{"hd and lyrics", "Channel", "Artist - Song (Lyrics) [HD]", nil, "Artist", "Song"},
+		{"keep remix", "Channel", "Artist - Song (Extended Remix)", nil, "Artist", "Song (Extended Remix)"},
+		{"noise tail", "Channel", "Artist - Song | Official Video", nil, "Artist", "Song"},
+		{"topic channel", "Artist - Topic", "Song", nil, "Artist", "Song"},
+		{"feat in title brackets", "Channel", "Artist - Song (ft. Guest)", nil, "Artist feat. Guest", "Song"},
+		{"feat in artist", "Channel", "Artist Feat Guest - Song", nil, "Artist feat. Guest", "Song"},
+		{"featuring bare", "Channel", "Artist - Song featuring Guest", nil, "Artist feat. Guest", "Song"},
+		{"feat in middle", "Channel", "Artist - Song (feat. Guest) (Official Audio)", nil, "Artist feat. Guest", "Song"},
+		{"no copyright", "Audio Library — Music for content creators", "Coral – LiQWYD (No Copyright Music)", nil, "LiQWYD", "Coral"},
+		{"ncs artist first", "NoCopyrightSounds", "Artist - Song [NCS Release]", nil, "Artist", "Song"},
+		{"user rule", "Free Music Channel", "Coral – LiQWYD (No Copyright Music)", swap, "LiQWYD", "Coral"},
+		{"bad user rule ignored", "Channel", "Artist - Song", []TitleRule{{Pattern: "("}}, "Artist", "Song"},
+		{"only noise", "Channel", "(Official Video)", nil, "Channel", "(Official Video)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artist, song := normalizeTrack(tt.channel, tt.title, tt.rules)
+			if artist != tt.artist || song != tt.song {
+				t.Errorf("normalizeTrack(%q, %q) = %q, %q; want %q, %q", tt.channel, tt.title, artist, song, tt.artist, tt.song)
+			}
+		})
+	}
+}
+
+func Test_parseTitleRule(t *testing.T) {
+	r, err := parseTitleRule(`\s*\(Slowed\)$ => `)
+	if err != nil || r.Pattern != `\s*\(Slowed\)$` || r.Replace != "" {
+		t.Errorf("parseTitleRule() = %+v, %v", r, err)
+	}
+	for _, bad := range []string{"", "=> x", "(unclosed => x"} {
+		if _, err := parseTitleRule(bad); err == nil {
+			t.Errorf("parseTitleRule(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	paramSort        = "sort"
+	paramSortReverse = "sort_reverse"
+	sortPlaylist     = "playlist"
+	sortAlpha        = "alpha"
+	sortDate         = "date"
+	sortDuration     = "duration"
+	// orderWait - wait of files in order, after it not ready files are sent later out of order
+	orderWait = 10 * time.Minute
+)
+
+// sortModes - variants of playlist order, alphabetical is default
+var sortModes = []string{sortAlpha, sortPlaylist, sortDate, sortDuration}
+
+// sortTitles - button names of sort modes
+var sortTitles = map[string]string{
+	sortAlpha:    "🔤 alphabetical",
+	sortPlaylist: "📋 playlist order",
+	sortDate:     "📅 publish date",
+	sortDuration: "⏱ duration",
+}
+
+// sortTracks([]*JsonPls, string, bool)
+// stable sort of elements by mode
+func sortTracks(list []*JsonPls, by string, reverse bool) {
+	less := func(a, b *JsonPls) bool {
+		switch by {
+		case sortPlaylist:
+			return a.Position < b.Position
+		case sortDate:
+			return a.Published.Before(b.Published)
+		case sortDuration:
+			return a.Duration < b.Duration
+		}
+		return a.Artist+a.Song < b.Artist+b.Song
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if reverse {
+			return less(list[j], list[i])
+		}
+		return less(list[i], list[j])
+	})
+}
+
+// sortMode() (string, bool)
+// order chosen by user and reverse flag
+func (o *botUser) sortMode() (string, bool) {
+	by := o.getParameter(paramParam, paramSort)
+	if !slices.Contains(sortModes, by) {
+		by = sortAlpha
+	}
+	return by, sBool(o.getParameter(paramParam, paramSortReverse))
+}
+
+// done()
+// element is processed (file for sending is ready or failed)
+func (o *JsonPls) done() {
+	if o.Ready != nil {
+		o.readyOnce.Do(func() { close(o.Ready) })
+	}
+}
+
+// sendOrdered(*Tasker, *Message)
+// send playlist files in sorted order, every file is sent when it and previous are ready.
+// Runs outside of workers, they are free for downloads, job waits it. Order is kept for orderWait on the whole job,
+// then slow files don't hold next ones and are sent later
+func (o *Query) sendOrdered(T *Tasker, message *Message) {
+	GetCtx[bool](T, sortinfoParamComplete, message)
+	usr := GetCtx[*botUser](T, userParam, message)
+	ext := mp4
+	if sBool(usr.getParameter(paramParam, mp3)) {
+		ext = usr.audioFormat().Ext
+	}
+	send := func(v *JsonPls) {
+		ext := ext
+		if ext == mp4 {
+			ext = v.videoExt()
+		}
+		if !debug && existFile(v.URLSaved+ext) != "" {
+			sendFiles(T, Thing{Input: v}, ext, message)
+		}
+	}
+	album := &albumSender{T: T, Message: message, Format: usr.audioFormat()}
+	o.M.RLock()
+	list := append([]*JsonPls(nil), o.Result...)
+	o.M.RUnlock()
+	// album gain needs all tracks, they are held until the end
+	gain := o.AlbumMode && usr.loudnessMode() == loudnessGain
+	var held []*JsonPls
+	deadline := time.NewTimer(orderWait)
+	defer deadline.Stop()
+	expired := false
+	var late sync.WaitGroup
+	for _, v := range list {
+		if !expired {
+			select {
+			case <-T.Branch.Context.Done():
+				return
+			case <-v.Ready:
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		select {
+		case <-v.Ready:
+		default:
+			v.toLog("is not ready, sent out of order", true)
+			late.Add(1)
+			go func() {
+				defer late.Done()
+				select {
+				case <-T.Branch.Context.Done():
+				case <-v.Ready:
+					send(v)
+				}
+			}()
+			continue
+		}
+		switch {
+		case !o.AlbumMode || debug || existFile(v.URLSaved+album.Format.Ext) == "":
+			send(v)
+		case gain && len(v.Parts) == 0:
+			held = append(held, v)
+		default:
+			album.add(v)
+		}
+	}
+	byAlbum := make(map[string][]*JsonPls)
+	for _, v := range held {
+		byAlbum[v.Album] = append(byAlbum[v.Album], v)
+	}
+	for _, tracks := range byAlbum {
+		albumGain(tracks, album.Format)
+	}
+	for _, v := range held {
+		album.add(v)
+	}
+	album.flush()
+	late.Wait()
+	o.sendSkipped(T, message)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_sortTracks(t *testing.T) {
+	track := func(pos int, artist, song string, published string, d time.Duration) *JsonPls {
+		v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{Position: pos, Artist: artist, Song: song}, Duration: d}
+		v.Published, _ = time.Parse("2006-01-02", published)
+		return v
+	}
+	list := []*JsonPls{
+		track(1, "B", "x", "2020-01-01", 3*time.Minute),
+		track(2, "A", "y", "2022-01-01", 1*time.Minute),
+		track(3, "C", "z", "2018-01-01", 2*time.Minute),
+	}
+	positions := func() []int {
+		var ret []int
+		for _, v := range list {
+			ret = append(ret, v.Position)
+		}
+		return ret
+	}
+	for _, tt := range []struct {
+		by      string
+		reverse bool
+		want    []int
+	}{
+		{sortAlpha, false, []int{2, 1, 3}},
+		{sortPlaylist, false, []int{1, 2, 3}},
+		{sortPlaylist, true, []int{3, 2, 1}},
+		{sortDate, false, []int{3, 1, 2}},
+		{sortDuration, false, []int{2, 3, 1}},
+		{sortDuration, true, []int{1, 3, 2}},
+	} {
+		sortTracks(list, tt.by, tt.reverse)
+		if got := positions(); sprintf("%v", got) != sprintf("%v", tt.want) {
+			t.Errorf("sortTracks(%s, reverse=%v) = %v, want %v", tt.by, tt.reverse, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pickerPageSize - tracks on one page of picker
+const pickerPageSize = 8
+
+// Picker - track selection of playlist preview. State is kept on server, callback data has only action
+type Picker struct {
+	Tracks   []*JsonPls
+	Selected []bool
+	Page     int
+}
+
+// newPicker([]*JsonPls) *Picker
+// picker with all tracks selected
+func newPicker(tracks []*JsonPls) *Picker {
+	o := &Picker{Tracks: tracks, Selected: make([]bool, len(tracks))}
+	for i := range o.Selected {
+		o.Selected[i] = true
+	}
+	return o
+}
+
+// pages() int
+// count of pages, minimum 1
+func (o *Picker) pages() int {
+	return max((len(o.Tracks)+pickerPageSize-1)/pickerPageSize, 1)
+}
+
+// count() int
+// count of selected tracks
+func (o *Picker) count() int {
+	n := 0
+	for _, v := range o.Selected {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// chosen() []*JsonPls
+// selected tracks in playlist order
+func (o *Picker) chosen() []*JsonPls {
+	ret := []*JsonPls{}
+	for i, v := range o.Tracks {
+		if o.Selected[i] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// apply(string) bool
+// change state by callback action: "t N" toggle track, "p N" page, "sa" all, "sn" none
+func (o *Picker) apply(action string) bool {
+	name, arg, _ := strings.Cut(action, " ")
+	n, err := strconv.Atoi(arg)
+	switch name {
+	case "t":
+		if err != nil || n < 0 || n >= len(o.Tracks) {
+			return false
+		}
+		o.Selected[n] = !o.Selected[n]
+	case "p":
+		if err != nil || n < 0 || n >= o.pages() {
+			return false
+		}
+		o.Page = n
+	case "sa", "sn":
+		for i := range o.Selected {
+			o.Selected[i] = name == "sa"
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// text(*Message) string
+// picker header
+func (o *Picker) text(message *Message) string {
+	return sprintf("%s: %d / %d. %s %d / %d", message.tr("Selected"), o.count(), len(o.Tracks), message.tr("Page"), o.Page+1, o.pages())
+}
+
+// keyboard(string, *Message) Button
+// track checkboxes of current page, navigation and actions
+func (o *Picker) keyboard(id string, message *Message) Button {
+	prefix := "/" + commandPreview + id + " "
+	var rows [][]ButtonOne
+	for i := o.Page * pickerPageSize; i < len(o.Tracks) && i < (o.Page+1)*pickerPageSize; i++ {
+		mark := "⬜"
+		if o.Selected[i] {
+			mark = "✅"
+		}
+		title := []rune(sprintf("%s %d. %s - %s", mark, i+1, o.Tracks[i].Artist, o.Tracks[i].Song))
+		if len(title) > 48 {
+			title = append(title[:47], '…')
+		}
+		rows = append(rows, []ButtonOne{{Text: string(title), CallbackData: prefix + sprintf("t %d", i)}})
+	}
+	var nav []ButtonOne
+	if o.Page > 0 {
+		nav = append(nav, ButtonOne{Text: "◀", CallbackData: prefix + sprintf("p %d", o.Page-1)})
+	}
+	nav = append(nav, ButtonOne{Text: sprintf("%d/%d", o.Page+1, o.pages()), CallbackData: prefix + sprintf("p %d", o.Page)})
+	if o.Page < o.pages()-1 {
+		nav = append(nav, ButtonOne{Text: "▶", CallbackData: prefix + sprintf("p %d", o.Page+1)})
+	}
+	rows = append(rows, nav)
+	rows = append(rows, []ButtonOne{
+		{Text: message.tr("☑ all"), CallbackData: prefix + "sa"},
+		{Text: message.tr("⬜ none"), CallbackData: prefix + "sn"},
+	})
+	rows = append(rows, []ButtonOne{
+		{Text: message.tr("⬇ Download selected") + sprintf(" (%d)", o.count()), CallbackData: prefix + "sel"},
+		{Text: message.tr("❌ Cancel"), CallbackData: prefix + "cancel"},
+	})
+	return Button{InlineKeyboard: rows}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Picker(t *testing.T) {
+	var tracks []*JsonPls
+	for i := 0; i < 20; i++ {
+		tracks = append(tracks, &JsonPls{JsonPlsMinimal: JsonPlsMinimal{Artist: strings.Repeat("Artist", 10), Song: sprintf("Song %d", i)}})
+	}
+	p := newPicker(tracks)
+	if p.pages() != 3 || p.count() != 20 {
+		t.Fatalf("pages %d, count %d", p.pages(), p.count())
+	}
+	p.apply("sn")
+	p.apply("t 0")
+	p.apply("t 19")
+	p.apply("t 19")
+	p.apply("t 5")
+	if got := p.chosen(); len(got) != 2 || got[0] != tracks[0] || got[1] != tracks[5] {
+		t.Errorf("chosen = %v", got)
+	}
+	for _, bad := range []string{"t 20", "t -1", "p 3", "x", "t"} {
+		if p.apply(bad) {
+			t.Errorf("apply(%q) accepted", bad)
+		}
+	}
+	if !p.apply("p 2") || p.Page != 2 {
+		t.Errorf("page = %d", p.Page)
+	}
+	kb := p.keyboard("0123abcd", &Message{MessageExt: MessageExt{LanguageCode: "en"}})
+	if len(kb.InlineKeyboard) != 4+3 {
+		t.Errorf("rows on last page = %d", len(kb.InlineKeyboard))
+	}
+	for _, row := range kb.InlineKeyboard {
+		for _, b := range row {
+			if len(b.CallbackData) > 64 {
+				t.Errorf("callback data %q is %d bytes", b.CallbackData, len(b.CallbackData))
+			}
+		}
+	}
+	if newPicker(nil).pages() != 1 {
+		t.Error("empty picker must have one page")
+	}
+}
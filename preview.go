@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html"
+	"strings"
+	"sync"
+	"time"
+)
+
+// previewTimeout - preview without answer is cancelled
+const previewTimeout = 30 * time.Minute
+
+// Preview - playlist waiting for user confirmation
+type Preview struct {
+	ID        string
+	ChatID    int64
+	Query     *Query
+	Choice    chan string
+	MessageID int64
+}
+
+// PreviewList - previews by short ID (callback data is limited by 64 bytes)
+type PreviewList struct {
+	Items map[string]*Preview
+	M     *sync.RWMutex
+}
+
+// Init() *PreviewList
+// new empty list
+func (o *PreviewList) Init() *PreviewList {
+	o.Items = make(map[string]*Preview)
+	o.M = new(sync.RWMutex)
+	return o
+}
+
+// Add(*Preview)
+// register preview with new ID
+func (o *PreviewList) Add(p *Preview) {
+	b := make([]byte, 4)
+	rand.Read(b)
+	o.M.Lock()
+	defer o.M.Unlock()
+	p.ID = hex.EncodeToString(b)
+	o.Items[p.ID] = p
+}
+
+// Get(string) *Preview
+// preview by ID, nil if not found
+func (o *PreviewList) Get(id string) *Preview {
+	o.M.RLock()
+	defer o.M.RUnlock()
+	return o.Items[id]
+}
+
+// Del(string)
+// remove finished preview
+func (o *PreviewList) Del(id string) {
+	o.M.Lock()
+	defer o.M.Unlock()
+	delete(o.Items, id)
+}
+
+// previewText(*Query, *botUser, *Message) string
+// playlist totals: tracks, duration, estimated size, skipped elements
+func previewText(q *Query, usr *botUser, message *Message) string {
+	q.M.RLock()
+	defer q.M.RUnlock()
+	var titles []string
+	for _, v := range q.Albums {
+		titles = append(titles, html.EscapeString(v.Title))
+	}
+	var duration time.Duration
+	for _, v := range q.Result {
+		duration += v.Duration
+	}
+	reasons := make(map[string]int)
+	filtered := 0
+	for _, v := range q.Skipped {
+		reasons[v.Reason]++
+		if strings.HasPrefix(v.Reason, "filter") {
+			filtered++
+		}
+	}
+	itag := usr.getParameter(paramParam, paramTypeVideo)
+	text := "<b>" + strings.Join(titles, ", ") + "</b>\n"
+	text += sprintf("%s: %d\n", message.tr("Tracks"), len(q.Result))
+	text += sprintf("%s: %s\n", message.tr("Duration"), formatDuration(duration))
+	if size := estimateSize(duration, itag); size > 0 {
+		text += sprintf("%s: ≈ %.1f MB (itag %s)\n", message.tr("Size"), float64(size)/(1<<20), itag)
+	}
+	if reasons["unavailable"] > 0 {
+		text += sprintf("%s: %d\n", message.tr("Unavailable"), reasons["unavailable"])
+	}
+	if reasons["double"] > 0 {
+		text += sprintf("%s: %d\n", message.tr("Duplicates"), reasons["double"])
+	}
+	if filtered > 0 {
+		text += sprintf("%s: %d\n", message.tr("Filtered out"), filtered)
+	}
+	if left := usr.tracksLeft(); left >= 0 {
+		text += sprintf("%s: %d /quota\n", message.tr("Tracks left in quota"), left)
+	}
+	return text
+}
+
+// previewButtons(string, *Message) Button
+// answers for preview
+func previewButtons(id string, message *Message) Button {
+	versions := make(map[string]string)
+	versions[message.tr("✅ Download all")] = "/" + commandPreview + id + " all"
+	versions[message.tr("☑ Choose tracks")] = "/" + commandPreview + id + " pick"
+	versions[message.tr("❌ Cancel")] = "/" + commandPreview + id + " cancel"
+	return Button{InlineKeyboard: buttomsMap(versions)}
+}
+
+// previewConfirm(*Query, *botUser) func(*Tasker, *Message) []*JsonPls
+// show playlist preview and wait user answer
+func (obj *Action) previewConfirm(q *Query, usr *botUser) func(*Tasker, *Message) []*JsonPls {
+	return func(T *Tasker, message *Message) []*JsonPls {
+		p := &Preview{ChatID: usr.Id, Query: q, Choice: make(chan string, 16)}
+		obj.Previews.Add(p)
+		defer obj.Previews.Del(p.ID)
+		m := *message
+		m.DelAfter = false
+		m.ParseMode = htmlMode
+		m.Text = previewText(q, usr, &m)
+		m.ReplyMarkup = previewButtons(p.ID, &m)
+		m.MessageId = m.sendMessage(T, sendParam)
+		p.MessageID = m.MessageId
+		return p.wait(T, usr, &m, func(source string) { m.sendMessage(T, source) })
+	}
+}
+
+// wait(*Tasker, *botUser, *Message, func(string)) []*JsonPls
+// handle answers until download or cancel, preview message m is edited through send
+func (p *Preview) wait(T *Tasker, usr *botUser, m *Message, send func(string)) []*JsonPls {
+	q := p.Query
+	finish := func(text string) {
+		m.Text = text
+		m.ReplyMarkup = Button{InlineKeyboard: [][]ButtonOne{}}
+		send(editParam)
+	}
+	var picker *Picker
+	for {
+		select {
+		case <-T.Branch.Context.Done():
+			finish(m.tr("Cancelled"))
+			return nil
+		case <-time.After(previewTimeout):
+			finish(m.tr("Preview expired"))
+			return nil
+		case choice := <-p.Choice:
+			switch choice {
+			case "all":
+				q.M.RLock()
+				all := append([]*JsonPls{}, q.Result...)
+				q.M.RUnlock()
+				finish(previewText(q, usr, m) + "\n" + m.tr("Downloading") + sprintf(": %d", len(all)))
+				return all
+			case "pick":
+				q.M.RLock()
+				picker = newPicker(append([]*JsonPls{}, q.Result...))
+				q.M.RUnlock()
+				m.Text = previewText(q, usr, m) + "\n" + picker.text(m)
+				m.ReplyMarkup = picker.keyboard(p.ID, m)
+				send(editParam)
+			case "sel":
+				if picker == nil || picker.count() == 0 {
+					break
+				}
+				finish(previewText(q, usr, m) + "\n" + m.tr("Downloading") + sprintf(": %d", picker.count()))
+				return picker.chosen()
+			case "cancel":
+				finish(m.tr("Cancelled"))
+				return nil
+			default:
+				if picker != nil && picker.apply(choice) {
+					m.Text = previewText(q, usr, m) + "\n" + picker.text(m)
+					m.ReplyMarkup = picker.keyboard(p.ID, m)
+					send(editParam)
+				}
+			}
+		}
+	}
+}
+
+// addPreviewCommands(*Commands, *Tasker)
+// answers for playlist preview buttons
+func (obj *Action) addPreviewCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandPreview, commandPreview, false, false, func(message Message, usr *botUser) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(message.Command, "/"+commandPreview), " ")
+		p := obj.Previews.Get(id)
+		if p == nil || p.ChatID != usr.Id {
+			message.Text = infoLabel + message.tr("Preview expired")
+			message.DelAfter = true
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		select {
+		case p.Choice <- action:
+		default:
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testPreview(t *testing.T) (*Query, *botUser) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "preview"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	t.Cleanup(db.Close)
+	usr := new(botUser).New(db, 1)
+	usr.setParameter(paramParam, paramTypeVideo, "140")
+	q := &Query{M: new(sync.RWMutex), Albums: map[string]AlbumInfo{"pl": {Title: "Rock & Roll"}}}
+	for i := 1; i <= 3; i++ {
+		q.Result = append(q.Result, &JsonPls{JsonPlsMinimal: JsonPlsMinimal{Position: i, Artist: "Artist", Song: sprintf("Song %d", i)}, Duration: time.Minute})
+	}
+	for _, reason := range []string{"unavailable", "double", "filter: first 3", "filter: words"} {
+		q.Skipped = append(q.Skipped, &JsonPls{JsonPlsMinimal: JsonPlsMinimal{Reason: reason}})
+	}
+	return q, usr
+}
+
+func Test_previewText(t *testing.T) {
+	q, usr := testPreview(t)
+	m := &Message{}
+	m.LanguageCode = "en"
+	text := previewText(q, usr, m)
+	for _, want := range []string{"<b>Rock &amp; Roll</b>", "Tracks: 3\n", "Duration: 3:00\n", "Size: ≈ 2.8 MB (itag 140)", "Unavailable: 1\n", "Duplicates: 1\n", "Filtered out: 2\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("previewText() = %q, no %q", text, want)
+		}
+	}
+	if strings.Contains(text, "quota") {
+		t.Errorf("quota line without limits: %q", text)
+	}
+}
+
+func Test_Preview_wait(t *testing.T) {
+	q, usr := testPreview(t)
+	T := new(Tasker).Init(1, 1)
+	for _, tt := range []struct {
+		choices []string
+		want    []int
+	}{
+		{[]string{"all"}, []int{1, 2, 3}},
+		{[]string{"sel", "t 0", "pick", "sn", "t 2", "t 0", "sel"}, []int{1, 3}},
+		{[]string{"pick", "t 1", "cancel"}, nil},
+	} {
+		p := &Preview{ID: "id", Query: q, Choice: make(chan string, len(tt.choices))}
+		for _, c := range tt.choices {
+			p.Choice <- c
+		}
+		m := &Message{}
+		m.LanguageCode = "en"
+		edits := 0
+		got := p.wait(T, usr, m, func(source string) {
+			if source == editParam {
+				edits++
+			}
+		})
+		var positions []int
+		for _, v := range got {
+			positions = append(positions, v.Position)
+		}
+		if sprintf("%v", positions) != sprintf("%v", tt.want) || edits == 0 {
+			t.Errorf("%v: chosen %v, want %v, edits %d", tt.choices, positions, tt.want, edits)
+		}
+		if b, ok := m.ReplyMarkup.(Button); !ok || len(b.InlineKeyboard) != 0 {
+			t.Errorf("%v: buttons are kept after answer", tt.choices)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	commandFormats = "formats"
+	commandQuality = "quality"
+	paramFallback  = "quality_fallback"
+	// pickerSize - formats in per-link picker
+	pickerSize = 16
+)
+
+// qualityHelp - grammar of fallback chain
+const qualityHelp = `<b>Quality fallback</b> - used if chosen quality is missing in video, rules are tried in order:
+<code>251</code> - exact itag
+<code>audio</code> - best audio, <code>audio&lt;=160k</code> - best audio not above 160 kbps
+<code>video</code> - best video with sound, <code>video&lt;=720</code> - not higher than 720p
+<code>any</code> - any stream with sound
+Example: <code>/quality audio&lt;=160k, audio, any</code>
+<code>/quality reset</code> - default chain
+<code>/formats https://youtu.be/...</code> - choose format of one video`
+
+var (
+	reQualityRule = regexp.MustCompile(`^(audio|video|any)(?:<=(\d+)(k|p)?)?$`)
+	reFormatsLink = regexp.MustCompile(`(?:v=|youtu\.be/|shorts/)([a-zA-Z0-9_-]{11})`)
+	reItagPrefix  = regexp.MustCompile(`^itag\s+(\d+)\s*`)
+)
+
+// QualityRule - one step of fallback chain
+type QualityRule struct {
+	Itag       int
+	Kind       string // audio, video, any
+	MaxBitrate int    // bit/s, 0 - any
+	MaxHeight  int    // 0 - any
+}
+
+// String() string
+// rule in grammar of /quality
+func (r QualityRule) String() string {
+	switch {
+	case r.Itag != 0:
+		return strconv.Itoa(r.Itag)
+	case r.MaxBitrate > 0:
+		return sprintf("%s<=%dk", r.Kind, r.MaxBitrate/1000)
+	case r.MaxHeight > 0:
+		return sprintf("%s<=%d", r.Kind, r.MaxHeight)
+	}
+	return r.Kind
+}
+
+// parseQualityChain(string) ([]QualityRule, error)
+// rules separated by comma or "else", like "audio<=160k, audio", nil for empty text
+func parseQualityChain(text string) ([]QualityRule, error) {
+	text = strings.NewReplacer("≤", "<=", " else ", ",", ";", ",", "kbps", "k").Replace(strings.ToLower(text))
+	var ret []QualityRule
+	for _, part := range strings.Split(text, ",") {
+		part = strings.Join(strings.Fields(part), "")
+		if part == "" {
+			continue
+		}
+		if itag, err := strconv.Atoi(part); err == nil && itag > 0 {
+			ret = append(ret, QualityRule{Itag: itag})
+			continue
+		}
+		m := reQualityRule.FindStringSubmatch(part)
+		if m == nil {
+			return nil, errors.New("unknown quality rule " + part)
+		}
+		r := QualityRule{Kind: m[1]}
+		if m[2] != "" {
+			n, _ := strconv.Atoi(m[2])
+			switch {
+			case n == 0:
+				return nil, errors.New("wrong limit " + part)
+			case m[3] == "k" || (m[3] == "" && m[1] == "audio"):
+				r.MaxBitrate = n * 1000
+			case m[1] == "audio":
+				return nil, errors.New("audio is limited by bitrate, like audio<=160k")
+			default:
+				r.MaxHeight = n
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// formatBitrate(*youtube.Format) int
+// average bitrate if known
+func formatBitrate(f *youtube.Format) int {
+	if f.AverageBitrate > 0 {
+		return f.AverageBitrate
+	}
+	return f.Bitrate
+}
+
+// match(*youtube.Format) bool
+// stream with sound fits rule
+func (r QualityRule) match(f *youtube.Format) bool {
+	if r.Itag != 0 {
+		return f.ItagNo == r.Itag
+	}
+	if f.AudioTrack != nil && !f.AudioTrack.AudioIsDefault {
+		return false // dubbed track
+	}
+	audioOnly := strings.HasPrefix(f.MimeType, "audio/")
+	switch {
+	case r.Kind == "audio" && !audioOnly, r.Kind == "video" && audioOnly:
+		return false
+	case r.MaxBitrate > 0 && formatBitrate(f) > r.MaxBitrate:
+		return false
+	case r.MaxHeight > 0 && f.Height > r.MaxHeight:
+		return false
+	}
+	return true
+}
+
+// selectFormat(youtube.FormatList, []QualityRule) (*youtube.Format, int)
+// best stream of first matched rule and index of rule, nil if no rule matched
+func selectFormat(list youtube.FormatList, chain []QualityRule) (*youtube.Format, int) {
+	for k, r := range chain {
+		var best *youtube.Format
+		for i := range list {
+			f := &list[i]
+			if f.AudioChannels == 0 || !r.match(f) {
+				continue
+			}
+			if best == nil || f.Height > best.Height || (f.Height == best.Height && formatBitrate(f) > formatBitrate(best)) {
+				best = f
+			}
+		}
+		if best != nil {
+			return best, k
+		}
+	}
+	return nil, -1
+}
+
+// defaultFallback(string) []QualityRule
+// fallback for quality of menu: same kind of stream, then anything with sound
+func defaultFallback(itag string) []QualityRule {
+	if isAudioItag(itag) {
+		return []QualityRule{{Kind: "audio"}, {Kind: "any"}}
+	}
+	return []QualityRule{{Kind: "video"}, {Kind: "any"}}
+}
+
+// qualityChain() []QualityRule
+// quality from menu first, then user fallback or default one
+func (o *botUser) qualityChain() []QualityRule {
+	itag := o.getParameter(paramParam, paramTypeVideo)
+	var ret []QualityRule
+	if h := adaptiveHeight(itag); h > 0 {
+		// HD mode without adaptive streams
+		ret = append(ret, QualityRule{Kind: "video", MaxHeight: h})
+	} else if n, err := strconv.Atoi(itag); err == nil {
+		ret = append(ret, QualityRule{Itag: n})
+	}
+	fallback, err := parseQualityChain(o.getParameter(paramParam, paramFallback))
+	if err != nil || len(fallback) == 0 {
+		fallback = defaultFallback(itag)
+	}
+	return append(ret, fallback...)
+}
+
+// chainText([]QualityRule) string
+// chain in grammar of /quality
+func chainText(chain []QualityRule) string {
+	var parts []string
+	for _, r := range chain {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cutItag(string) (int, string)
+// itag chosen in format picker and rest of selector
+func cutItag(selector string) (int, string) {
+	m := reItagPrefix.FindStringSubmatch(selector)
+	if m == nil {
+		return 0, selector
+	}
+	itag, _ := strconv.Atoi(m[1])
+	return itag, selector[len(m[0]):]
+}
+
+// formatsLinkID(string) string
+// video ID of /formats argument: link or ID
+func formatsLinkID(text string) string {
+	if m := reFormatsLink.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return strings.TrimSpace(text)
+}
+
+// pickerFormats(youtube.FormatList, bool) []youtube.Format
+// formats for picker: audio mode - streams with sound, video mode - video streams, best first
+func pickerFormats(list youtube.FormatList, audioMode bool) []youtube.Format {
+	var ret []youtube.Format
+	for _, f := range list {
+		if f.AudioTrack != nil && !f.AudioTrack.AudioIsDefault {
+			continue
+		}
+		audioOnly := strings.HasPrefix(f.MimeType, "audio/")
+		if (audioMode && f.AudioChannels == 0) || (!audioMode && audioOnly) {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Height != ret[j].Height {
+			return ret[i].Height > ret[j].Height
+		}
+		return formatBitrate(&ret[i]) > formatBitrate(&ret[j])
+	})
+	ret = slices.CompactFunc(ret, func(a, b youtube.Format) bool { return a.ItagNo == b.ItagNo })
+	if len(ret) > pickerSize {
+		ret = ret[:pickerSize]
+	}
+	return ret
+}
+
+// formatLabel(*youtube.Format, time.Duration) string
+// itag, resolution, codec, bitrate and size of format
+func formatLabel(f *youtube.Format, d time.Duration) string {
+	label := strconv.Itoa(f.ItagNo)
+	if f.QualityLabel != "" {
+		label += " " + f.QualityLabel
+	}
+	label += " " + mimeCodec(f.MimeType)
+	if f.AudioChannels == 0 {
+		label += "+audio"
+	}
+	label += sprintf(" %dk", formatBitrate(f)/1000)
+	if size := streamSize(f, d); size > 0 {
+		label += sprintf(" %.1fMB", float64(size)/(1<<20))
+	}
+	return label
+}
+
+// addQualityCommands(*Commands, *Tasker)
+// commands 'formats' (picker of one video) and 'quality' (fallback chain)
+func (obj *Action) addQualityCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandFormats, "🎚formats", false, false, func(message Message, usr *botUser) {
+		id := formatsLinkID(commandArgument(message, commandFormats))
+		message.DelBefore = true
+		if len(id) != 11 {
+			message.Text = qualityHelp
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		video, err := new(youtube.Client).GetVideo(id)
+		if err != nil {
+			message.Text = infoLabel + html.EscapeString(err.Error())
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		list := pickerFormats(video.Formats, sBool(usr.getParameter(paramParam, mp3)))
+		if len(list) == 0 {
+			message.Text = infoLabel + message.tr("No formats") + ": " + html.EscapeString(video.Title)
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		message.Text = "🎚 " + html.EscapeString(video.Title)
+		versions := make(map[string]string)
+		for k := range list {
+			label := formatLabel(&list[k], video.Duration)
+			message.Text += "\n<code>" + html.EscapeString(label) + "</code>"
+			versions[label] = commandFind + id + " itag " + strconv.Itoa(list[k].ItagNo)
+		}
+		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(versions)}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add(commandQuality, "🎚quality", false, false, func(message Message, usr *botUser) {
+		arg := strings.ToLower(commandArgument(message, commandQuality))
+		message.DelBefore = true
+		chain, err := parseQualityChain(arg)
+		switch {
+		case arg == "":
+			message.Text = message.tr("Quality chain") + ": <code>" + html.EscapeString(chainText(usr.qualityChain())) + "</code>\n\n" + qualityHelp
+		case arg == "reset":
+			usr.setParameter(paramParam, paramFallback, "")
+			message.Text = message.tr("Quality chain") + ": <code>" + html.EscapeString(chainText(usr.qualityChain())) + "</code>"
+		case err != nil:
+			message.Text = infoLabel + html.EscapeString(err.Error()) + "\n\n" + qualityHelp
+		default:
+			usr.setParameter(paramParam, paramFallback, chainText(chain))
+			message.Text = message.tr("Quality chain") + ": <code>" + html.EscapeString(chainText(usr.qualityChain())) + "</code>"
+		}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+}
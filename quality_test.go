@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func Test_parseQualityChain(t *testing.T) {
+	for _, tt := range []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"251, audio", "251, audio", false},
+		{"audio ≤ 160 kbps else audio", "audio<=160k, audio", false},
+		{"audio<=160k; any", "audio<=160k, any", false},
+		{"video<=720p, video<=2000k", "video<=720, video<=2000k", false},
+		{"AUDIO<=128", "audio<=128k", false},
+		{"audio<=720p", "", true},
+		{"video<=0", "", true},
+		{"best", "", true},
+	} {
+		chain, err := parseQualityChain(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQualityChain(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got := chainText(chain); !tt.wantErr && got != tt.want {
+			t.Errorf("parseQualityChain(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_selectFormat(t *testing.T) {
+	list := youtube.FormatList{
+		{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Height: 360, AudioChannels: 2, Bitrate: 500000},
+		{ItagNo: 137, MimeType: `video/mp4; codecs="avc1.640028"`, Height: 1080, Bitrate: 4000000},
+		{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, AudioChannels: 2, Bitrate: 130000},
+		{ItagNo: 251, MimeType: `audio/webm; codecs="opus"`, AudioChannels: 2, Bitrate: 170000, AverageBitrate: 140000},
+		{ItagNo: 249, MimeType: `audio/webm; codecs="opus"`, AudioChannels: 2, Bitrate: 55000},
+	}
+	for _, tt := range []struct {
+		chain string
+		itag  int
+		rule  int
+	}{
+		{"251, audio", 251, 0},
+		{"22, video", 18, 1},
+		{"250, audio<=135k, audio", 140, 1},
+		{"audio<=50k, audio", 251, 1},
+		{"video<=240, any", 18, 1},
+		{"137, 22", 0, -1},
+	} {
+		chain, _ := parseQualityChain(tt.chain)
+		f, rule := selectFormat(list, chain)
+		itag := 0
+		if f != nil {
+			itag = f.ItagNo
+		}
+		if itag != tt.itag || rule != tt.rule {
+			t.Errorf("selectFormat(%q) = %d, rule %d, want %d, rule %d", tt.chain, itag, rule, tt.itag, tt.rule)
+		}
+	}
+	if got := pickerFormats(list, true); len(got) != 4 || got[0].ItagNo != 18 || got[1].ItagNo != 251 {
+		t.Errorf("pickerFormats(audio) = %v", got)
+	}
+	if got := pickerFormats(list, false); len(got) != 2 || got[0].ItagNo != 137 {
+		t.Errorf("pickerFormats(video) = %v", got)
+	}
+	if got := formatLabel(&list[1], 8*time.Second); got != "137 avc1.640028+audio 4000k 3.8MB" {
+		t.Errorf("formatLabel() = %q", got)
+	}
+}
+
+func Test_cutItag(t *testing.T) {
+	for _, tt := range []struct {
+		selector string
+		itag     int
+		rest     string
+	}{
+		{"itag 251", 251, ""},
+		{"itag 137 1:20-2:05", 137, "1:20-2:05"},
+		{"1:20-2:05", 0, "1:20-2:05"},
+	} {
+		itag, rest := cutItag(tt.selector)
+		if itag != tt.itag || rest != tt.rest {
+			t.Errorf("cutItag(%q) = %d, %q, want %d, %q", tt.selector, itag, rest, tt.itag, tt.rest)
+		}
+	}
+	if got := formatsLinkID("https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10"); got != "dQw4w9WgXcQ" {
+		t.Errorf("formatsLinkID() = %q", got)
+	}
+}
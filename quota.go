@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota - usage or limit values. Zero limit is unlimited
+type Quota struct {
+	Tracks  int64
+	Bytes   int64
+	Minutes int64
+}
+
+// QuotaLimits - per user limits
+type QuotaLimits struct {
+	Day   Quota
+	Month Quota
+	Jobs  int
+}
+
+var (
+	quotaLimits QuotaLimits
+	quotaM      sync.Mutex
+)
+
+// parseQuotaLimits() QuotaLimits
+// limits from envs QUOTA_DAY_TRACKS, QUOTA_DAY_MB, QUOTA_DAY_MINUTES, QUOTA_MONTH_*, QUOTA_JOBS
+func parseQuotaLimits() QuotaLimits {
+	env := func(name string) int64 {
+		v, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+		return v
+	}
+	var ret QuotaLimits
+	ret.Day = Quota{Tracks: env("QUOTA_DAY_TRACKS"), Bytes: env("QUOTA_DAY_MB") << 20, Minutes: env("QUOTA_DAY_MINUTES")}
+	ret.Month = Quota{Tracks: env("QUOTA_MONTH_TRACKS"), Bytes: env("QUOTA_MONTH_MB") << 20, Minutes: env("QUOTA_MONTH_MINUTES")}
+	ret.Jobs = int(env("QUOTA_JOBS"))
+	return ret
+}
+
+// exceeded(Quota) string
+// name of first value over limit, empty if none
+func (o Quota) exceeded(limit Quota) string {
+	switch {
+	case limit.Tracks > 0 && o.Tracks > limit.Tracks:
+		return "tracks"
+	case limit.Bytes > 0 && o.Bytes > limit.Bytes:
+		return "bytes"
+	case limit.Minutes > 0 && o.Minutes > limit.Minutes:
+		return "minutes"
+	}
+	return ""
+}
+
+// add(Quota) Quota
+// sum of usage
+func (o Quota) add(val Quota) Quota {
+	return Quota{Tracks: o.Tracks + val.Tracks, Bytes: o.Bytes + val.Bytes, Minutes: o.Minutes + val.Minutes}
+}
+
+// sub(Quota) Quota
+// usage without refunded values, not less than zero
+func (o Quota) sub(val Quota) Quota {
+	return Quota{Tracks: max(o.Tracks-val.Tracks, 0), Bytes: max(o.Bytes-val.Bytes, 0), Minutes: max(o.Minutes-val.Minutes, 0)}
+}
+
+// quotaKeys(time.Time) (string, string)
+// database keys for day and month usage
+func quotaKeys(t time.Time) (string, string) {
+	return "usage_" + t.Format("2006-01-02"), "usage_" + t.Format("2006-01")
+}
+
+// usage(string) Quota
+// usage by database key
+func (o *botUser) usage(key string) Quota {
+	var q Quota
+	json.Unmarshal([]byte(o.getDbVal(key)), &q)
+	return q
+}
+
+// setUsage(string, Quota)
+// save usage by database key
+func (o *botUser) setUsage(key string, q Quota) {
+	data, _ := json.Marshal(q)
+	o.Db.FindCreate(o.Sid).Put(key, string(data))
+}
+
+// usageNow() (Quota, Quota)
+// usage for current day and month
+func (o *botUser) usageNow() (Quota, Quota) {
+	day, month := quotaKeys(time.Now())
+	return o.usage(day), o.usage(month)
+}
+
+// reserveQuota(Quota) string
+// add usage if limits allow. Return name of exceeded value (and usage not changed)
+func (o *botUser) reserveQuota(val Quota) string {
+	if o.isAdmin() {
+		return ""
+	}
+	quotaM.Lock()
+	defer quotaM.Unlock()
+	dayKey, monthKey := quotaKeys(time.Now())
+	day, month := o.usage(dayKey).add(val), o.usage(monthKey).add(val)
+	if v := day.exceeded(quotaLimits.Day); v != "" {
+		return "daily " + v
+	}
+	if v := month.exceeded(quotaLimits.Month); v != "" {
+		return "monthly " + v
+	}
+	o.setUsage(dayKey, day)
+	o.setUsage(monthKey, month)
+	o.pruneUsage(time.Now())
+	return ""
+}
+
+// refundQuota(Quota, time.Time)
+// give back usage reserved at time for failed work
+func (o *botUser) refundQuota(val Quota, at time.Time) {
+	if o.isAdmin() || val == (Quota{}) {
+		return
+	}
+	quotaM.Lock()
+	defer quotaM.Unlock()
+	dayKey, monthKey := quotaKeys(at)
+	o.setUsage(dayKey, o.usage(dayKey).sub(val))
+	o.setUsage(monthKey, o.usage(monthKey).sub(val))
+}
+
+// pruneUsage(time.Time)
+// delete usage of old days and months, yesterday and last month are kept for refunds
+func (o *botUser) pruneUsage(now time.Time) {
+	bucket := o.Db.FindCreate(o.Sid)
+	for k := range bucket.PrintAllPrefix("usage_") {
+		date := strings.TrimPrefix(k, "usage_")
+		if t, err := time.ParseInLocation("2006-01-02", date, now.Location()); err == nil {
+			if now.Sub(t) > 48*time.Hour {
+				bucket.Del(k)
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation("2006-01", date, now.Location()); err == nil && t.AddDate(0, 2, 0).Before(now) {
+			bucket.Del(k)
+		}
+	}
+}
+
+// QuotaHold - quota reserved for element of job, it is refunded if element fails
+type QuotaHold struct {
+	m    sync.Mutex
+	val  Quota
+	at   time.Time
+	kept bool
+}
+
+// reserve(*botUser, Quota) string
+// reserve quota of user and remember it. Return name of exceeded value
+func (o *QuotaHold) reserve(usr *botUser, val Quota) string {
+	if reason := usr.reserveQuota(val); reason != "" {
+		return reason
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.val == (Quota{}) {
+		o.at = time.Now()
+	}
+	o.val = o.val.add(val)
+	return ""
+}
+
+// keep()
+// element is done, reserved quota is used
+func (o *QuotaHold) keep() {
+	o.m.Lock()
+	o.kept = true
+	o.m.Unlock()
+}
+
+// refund(*botUser)
+// give back quota of element which was not done
+func (o *QuotaHold) refund(usr *botUser) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.kept {
+		return
+	}
+	usr.refundQuota(o.val, o.at)
+	o.val = Quota{}
+}
+
+// addUsage(Quota)
+// add usage without limits check (real size known after download)
+func (o *botUser) addUsage(val Quota) {
+	if o.isAdmin() || val == (Quota{}) {
+		return
+	}
+	quotaM.Lock()
+	defer quotaM.Unlock()
+	dayKey, monthKey := quotaKeys(time.Now())
+	o.setUsage(dayKey, o.usage(dayKey).add(val))
+	o.setUsage(monthKey, o.usage(monthKey).add(val))
+}
+
+// tracksLeft() int64
+// how many tracks user can download now, -1 if unlimited
+func (o *botUser) tracksLeft() int64 {
+	if o.isAdmin() {
+		return -1
+	}
+	day, month := o.usageNow()
+	left := int64(-1)
+	for _, v := range [][2]int64{{quotaLimits.Day.Tracks, day.Tracks}, {quotaLimits.Month.Tracks, month.Tracks}} {
+		if v[0] > 0 && (left < 0 || v[0]-v[1] < left) {
+			left = max(v[0]-v[1], 0)
+		}
+	}
+	return left
+}
+
+// quotaMinutes(time.Duration) int64
+// conversion minutes for duration, started minute is counted
+func quotaMinutes(d time.Duration) int64 {
+	return int64(math.Ceil(d.Minutes()))
+}
+
+// quotaText(*Message) string
+// human readable usage and limits
+func (o *botUser) quotaText(message *Message) string {
+	day, month := o.usageNow()
+	line := func(name string, used, limit int64, mb bool) string {
+		format := func(v int64) string {
+			if mb {
+				return sprintf("%.1f MB", float64(v)/(1<<20))
+			}
+			return sprintf("%d", v)
+		}
+		if limit <= 0 {
+			return sprintf("%s: %s / ∞\n", message.tr(name), format(used))
+		}
+		return sprintf("%s: %s / %s (%s %s)\n", message.tr(name), format(used), format(limit), message.tr("left"), format(max(limit-used, 0)))
+	}
+	text := "<b>" + message.tr("Today") + "</b>\n"
+	text += line("tracks", day.Tracks, quotaLimits.Day.Tracks, false)
+	text += line("downloaded", day.Bytes, quotaLimits.Day.Bytes, true)
+	text += line("conversion minutes", day.Minutes, quotaLimits.Day.Minutes, false)
+	text += "<b>" + message.tr("This month") + "</b>\n"
+	text += line("tracks", month.Tracks, quotaLimits.Month.Tracks, false)
+	text += line("downloaded", month.Bytes, quotaLimits.Month.Bytes, true)
+	text += line("conversion minutes", month.Minutes, quotaLimits.Month.Minutes, false)
+	if quotaLimits.Jobs > 0 {
+		text += sprintf("%s: %d\n", message.tr("parallel jobs"), quotaLimits.Jobs)
+	}
+	if o.isAdmin() {
+		text += message.tr("Admin: no limits")
+	}
+	return text
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_quota_reserve(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "quota"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	defer func(v QuotaLimits) { quotaLimits = v }(quotaLimits)
+	quotaLimits = QuotaLimits{Day: Quota{Tracks: 2}, Month: Quota{Minutes: 10}}
+	usr := new(botUser).New(db, 1)
+	if r := usr.reserveQuota(Quota{Tracks: 1, Minutes: 4}); r != "" {
+		t.Fatalf("first track refused: %s", r)
+	}
+	if r := usr.reserveQuota(Quota{Tracks: 1, Minutes: 7}); r != "monthly minutes" {
+		t.Fatalf("got %q, want monthly minutes", r)
+	}
+	if left := usr.tracksLeft(); left != 1 {
+		t.Errorf("tracks left = %d, want 1", left)
+	}
+	if r := usr.reserveQuota(Quota{Tracks: 1}); r != "" {
+		t.Fatalf("second track refused: %s", r)
+	}
+	if r := usr.reserveQuota(Quota{Tracks: 1}); r != "daily tracks" {
+		t.Fatalf("got %q, want daily tracks", r)
+	}
+	day, month := usr.usageNow()
+	if day.Tracks != 2 || month.Minutes != 4 {
+		t.Errorf("usage day=%+v month=%+v", day, month)
+	}
+}
+
+func Test_quota_refund(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "refund"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	defer func(v QuotaLimits) { quotaLimits = v }(quotaLimits)
+	quotaLimits = QuotaLimits{Day: Quota{Tracks: 1}}
+	usr := new(botUser).New(db, 1)
+	failed, done := new(JsonPls), new(JsonPls)
+	if r := failed.Hold.reserve(usr, Quota{Tracks: 1, Bytes: 100}); r != "" {
+		t.Fatalf("track refused: %s", r)
+	}
+	if r := done.Hold.reserve(usr, Quota{Tracks: 1}); r != "daily tracks" {
+		t.Fatalf("got %q, want daily tracks", r)
+	}
+	failed.Hold.refund(usr)
+	failed.Hold.refund(usr) // second refund gives nothing
+	if day, month := usr.usageNow(); day != (Quota{}) || month != (Quota{}) {
+		t.Errorf("usage after refund day=%+v month=%+v", day, month)
+	}
+	if r := done.Hold.reserve(usr, Quota{Tracks: 1, Minutes: 3}); r != "" {
+		t.Fatalf("track refused after refund: %s", r)
+	}
+	done.Hold.keep()
+	done.Hold.refund(usr)
+	if day, _ := usr.usageNow(); day.Tracks != 1 || day.Minutes != 3 {
+		t.Errorf("done track is refunded: %+v", day)
+	}
+	now := time.Now()
+	old := now.AddDate(0, -3, 0)
+	for _, at := range []time.Time{old, now.AddDate(0, 0, -3), now.AddDate(0, 0, -1), now.AddDate(0, -1, 0)} {
+		day, month := quotaKeys(at)
+		usr.setUsage(day, Quota{Tracks: 1})
+		usr.setUsage(month, Quota{Tracks: 1})
+	}
+	usr.pruneUsage(now)
+	left := usr.getDbVals("", "usage_")
+	for _, at := range []time.Time{old, now.AddDate(0, 0, -3)} {
+		if day, _ := quotaKeys(at); left[day] != "" {
+			t.Errorf("%s is kept", day)
+		}
+	}
+	if _, month := quotaKeys(old); left[month] != "" {
+		t.Errorf("%s is kept", month)
+	}
+	yesterday, _ := quotaKeys(now.AddDate(0, 0, -1))
+	_, lastMonth := quotaKeys(now.AddDate(0, -1, 0))
+	if left[yesterday] == "" || left[lastMonth] == "" {
+		t.Errorf("usage for refunds is pruned: %v", left)
+	}
+}
+
+func Test_JobList_TryStart(t *testing.T) {
+	jobs := new(JobList).Init()
+	usr := &botUser{}
+	started := 0
+	for k := 0; k < 5; k++ {
+		message := &Message{}
+		message.UUID = sprintf("job%d", k)
+		message.ChatID = 7
+		if _, ok := jobs.TryStart(message, usr, "link", nil, 2); ok {
+			started++
+		}
+	}
+	if started != 2 || len(jobs.ByChat(7)) != 2 {
+		t.Errorf("started %d jobs, want 2", started)
+	}
+}
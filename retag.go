@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	commandTag = "tag"
+	// sentPrefix - database key of sent audio record, message ID follows
+	sentPrefix = "sent_"
+	// sentKeep - count of last sent audio which can be retagged
+	sentKeep = 200
+	tagSwap  = "swap"
+)
+
+var tagHelp = `Reply to audio sent by bot:
+<code>/tag Artist - Title</code> - set artist and title
+<code>/tag Title</code> - set only title
+<code>/tag swap</code> - swap artist and title
+File is tagged again without YouTube and sent back.`
+
+// reTagTarget - message ID of audio in command from buttons of edit form
+var reTagTarget = regexp.MustCompile(`^#(\d+)\s*`)
+
+// SentAudio - record of audio sent to chat, used for retagging
+type SentAudio struct {
+	FileID  string
+	Name    string
+	VideoID string `json:",omitempty"`
+	Artist  string
+	Song    string
+	Sent    time.Time
+}
+
+// replyMedia(*Result) MediaFile
+// audio or audio document of replied message
+func replyMedia(val *Result) MediaFile {
+	r := val.Message.ReplyToMessage
+	ret := MediaFile{MessageID: r.MessageID}
+	switch {
+	case r.Audio.FileID != "":
+		ret.Kind, ret.FileID, ret.FileName, ret.FileSize = "audio", r.Audio.FileID, r.Audio.FileName, r.Audio.FileSize
+		ret.Performer, ret.Title = r.Audio.Performer, r.Audio.Title
+	case r.Document.FileID != "":
+		ret.Kind, ret.FileID, ret.FileName, ret.FileSize = "document", r.Document.FileID, r.Document.FileName, r.Document.FileSize
+	}
+	return ret
+}
+
+// newSentAudio(DocumentMessage, string) SentAudio
+// record of sent file, artist and title are taken from tags of file
+func newSentAudio(src DocumentMessage, fileID string) SentAudio {
+	ret := SentAudio{FileID: fileID, Name: filepath.Base(src.Src), VideoID: src.VideoID, Sent: time.Now()}
+	if tags, _, err := readFileTags(src.Src); err == nil {
+		ret.Artist, ret.Song = tags["artist"], tags["title"]
+	}
+	return ret
+}
+
+// rememberSent(int64, SentAudio)
+// save record by message ID, records over sentKeep are removed from oldest
+func (o *botUser) rememberSent(messageID int64, rec SentAudio) {
+	data, _ := json.Marshal(rec)
+	bucket := o.Db.FindCreate(o.Sid)
+	bucket.Put(sentPrefix+strconv.FormatInt(messageID, 10), string(data))
+	var ids []int64
+	for k := range bucket.PrintAllPrefix(sentPrefix) {
+		if id, err := strconv.ParseInt(strings.TrimPrefix(k, sentPrefix), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for k := 0; k < len(ids)-sentKeep; k++ {
+		bucket.Del(sentPrefix + strconv.FormatInt(ids[k], 10))
+	}
+}
+
+// sentAudio(int64) (SentAudio, bool)
+// record of audio sent in message
+func (o *botUser) sentAudio(messageID int64) (SentAudio, bool) {
+	var rec SentAudio
+	data := o.getDbVal(sentPrefix + strconv.FormatInt(messageID, 10))
+	if data == "" || json.Unmarshal([]byte(data), &rec) != nil {
+		return rec, false
+	}
+	return rec, true
+}
+
+// replyAudio(MediaFile) (SentAudio, bool)
+// record of replied audio, audio which was sent before records is taken from reply itself
+func (o *botUser) replyAudio(reply MediaFile) (SentAudio, bool) {
+	if rec, ok := o.sentAudio(reply.MessageID); ok {
+		return rec, true
+	}
+	if reply.FileID == "" || !isAudioExt(strings.ToLower(filepath.Ext(reply.FileName))) {
+		return SentAudio{}, false
+	}
+	return SentAudio{FileID: reply.FileID, Name: filepath.Base(reply.FileName), Artist: reply.Performer, Song: reply.Title}, true
+}
+
+// cutTagTarget(string) (int64, string)
+// message ID from "#123 ..." and rest of argument
+func cutTagTarget(arg string) (int64, string) {
+	m := reTagTarget.FindStringSubmatch(arg)
+	if m == nil {
+		return 0, arg
+	}
+	id, _ := strconv.ParseInt(m[1], 10, 64)
+	return id, strings.TrimSpace(arg[len(m[0]):])
+}
+
+// parseTagArg(string, SentAudio) (string, string, error)
+// new artist and title: "Artist - Title", "Title" (artist is kept) or "swap"
+func parseTagArg(arg string, rec SentAudio) (string, string, error) {
+	arg = strings.TrimSpace(arg)
+	if strings.EqualFold(arg, tagSwap) {
+		if rec.Artist == "" || rec.Song == "" {
+			return "", "", errors.New("nothing to swap")
+		}
+		return rec.Song, rec.Artist, nil
+	}
+	// first separator, dashes inside names (AC-DC) are kept
+	pad := " " + arg + " "
+	pos, size := -1, 0
+	for _, sep := range []string{" - ", " – ", " — "} {
+		if k := strings.Index(pad, sep); k >= 0 && (pos < 0 || k < pos) {
+			pos, size = k, len(sep)
+		}
+	}
+	if pos >= 0 {
+		artist, song := strings.TrimSpace(pad[:pos]), strings.TrimSpace(pad[pos+size:])
+		if artist == "" || song == "" {
+			return "", "", errors.New("empty artist or title")
+		}
+		return artist, song, nil
+	}
+	if arg == "" {
+		return "", "", errors.New("empty title")
+	}
+	return rec.Artist, arg, nil
+}
+
+// retag(SentAudio, string, string, string, *botUser) (string, error)
+// download sent audio, set artist and title, rename by filename template. Return path of file
+func retag(rec SentAudio, artist, song, folder string, usr *botUser) (string, error) {
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(rec.Name))
+	src := filepath.Join(folder, "retag"+ext)
+	if err := getTelegramFile(rec.FileID, src); err != nil {
+		return "", err
+	}
+	if err := updateFileTags(src, map[string]string{"artist": artist, "title": song}); err != nil {
+		os.Remove(src)
+		return "", err
+	}
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: rec.VideoID, Artist: artist, Song: song}}
+	path := filepath.Join(folder, fileName(v, usr.nameTemplate())+ext)
+	if err := os.Rename(src, path); err != nil {
+		os.Remove(src)
+		return "", err
+	}
+	return path, nil
+}
+
+// addTagCommands(*Commands, *Tasker)
+// command 'tag' in reply to sent audio changes artist and title
+func (obj *Action) addTagCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandTag, "🏷tag", false, false, func(message Message, usr *botUser) {
+		target, arg := cutTagTarget(commandArgument(message, commandTag))
+		message.DelBefore = true
+		rec, ok := usr.sentAudio(target)
+		if target == 0 {
+			target = message.Reply.MessageID
+			rec, ok = usr.replyAudio(message.Reply)
+		}
+		if !ok {
+			message.Text = tagHelp
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		if arg == "" {
+			// edit form: current tags and quick actions for this audio, buttons find it by record
+			usr.rememberSent(target, rec)
+			message.Text = "🏷 <code>" + html.EscapeString(rec.Artist+" - "+rec.Song) + "</code>\n\n" + tagHelp
+			actions := make(map[string]string)
+			actions[message.tr("⇄ swap artist and title")] = sprintf("/%s #%d %s", commandTag, target, tagSwap)
+			actions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+			message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(actions)}
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		artist, song, err := parseTagArg(arg, rec)
+		if err != nil {
+			message.Text = infoLabel + html.EscapeString(err.Error()) + "\n\n" + tagHelp
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		path, err := retag(rec, artist, song, filepath.Join(message.UUID, commandTag), usr)
+		if err != nil {
+			message.Text = infoLabel + message.tr("Audio was not retagged") + ": " + html.EscapeString(err.Error())
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		param := DocumentMessage{}
+		param.Src = path
+		param.Check = true
+		param.Title = artist + " [" + song + "]"
+		param.User = usr
+		param.VideoID = rec.VideoID
+		MainTasker.Add(param, message.SendDocumentWrapperTask, &message)
+	})
+}
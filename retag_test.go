@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseTagArg(t *testing.T) {
+	rec := SentAudio{Artist: "Song", Song: "Artist"}
+	for _, tt := range []struct {
+		arg          string
+		artist, song string
+		wantErr      bool
+	}{
+		{"Artist - Title", "Artist", "Title", false},
+		{"  AC-DC – Back in Black - Live ", "AC-DC", "Back in Black - Live", false},
+		{"New Title", "Song", "New Title", false},
+		{"SWAP", "Artist", "Song", false},
+		{" - Title", "", "", true},
+		{"", "", "", true},
+	} {
+		artist, song, err := parseTagArg(tt.arg, rec)
+		if (err != nil) != tt.wantErr || artist != tt.artist || song != tt.song {
+			t.Errorf("parseTagArg(%q) = %q, %q, %v", tt.arg, artist, song, err)
+		}
+	}
+	if _, _, err := parseTagArg(tagSwap, SentAudio{Song: "Only"}); err == nil {
+		t.Error("swap without artist is accepted")
+	}
+	if id, rest := cutTagTarget("#42 swap"); id != 42 || rest != "swap" {
+		t.Errorf("cutTagTarget() = %d, %q", id, rest)
+	}
+	if id, rest := cutTagTarget("#1 - Song"); id != 1 || rest != "- Song" {
+		t.Errorf("cutTagTarget() = %d, %q", id, rest)
+	}
+}
+
+func Test_sentAudio(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "sent"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	usr := new(botUser).New(db, 1)
+	for k := int64(1); k <= sentKeep+5; k++ {
+		usr.rememberSent(k, SentAudio{FileID: sprintf("file%d", k), Name: "a.mp3"})
+	}
+	if _, ok := usr.sentAudio(5); ok {
+		t.Error("oldest record is kept")
+	}
+	if rec, ok := usr.sentAudio(sentKeep + 5); !ok || rec.FileID != sprintf("file%d", sentKeep+5) {
+		t.Errorf("last record = %+v, %v", rec, ok)
+	}
+	if n := len(usr.getDbVals("", sentPrefix)); n != sentKeep {
+		t.Errorf("records = %d, want %d", n, sentKeep)
+	}
+	rec, ok := usr.replyAudio(MediaFile{MessageID: 999, FileID: "x", FileName: "Old.ogg", Performer: "A", Title: "B"})
+	if !ok || rec.FileID != "x" || rec.Artist != "A" || rec.Song != "B" {
+		t.Errorf("replyAudio() = %+v, %v", rec, ok)
+	}
+	if _, ok := usr.replyAudio(MediaFile{MessageID: 999, FileID: "x", FileName: "clip.mp4"}); ok {
+		t.Error("video is accepted for retagging")
+	}
+}
+
+func Test_newSentAudio(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	data, err := writeID3(syntheticMP3(), map[string]string{"artist": "Artist", "title": "Title"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, data, 0666)
+	rec := newSentAudio(DocumentMessage{Src: path, VideoID: "abc123"}, "file")
+	if rec.Name != "track.mp3" || rec.Artist != "Artist" || rec.Song != "Title" || rec.VideoID != "abc123" || rec.FileID != "file" {
+		t.Errorf("newSentAudio() = %+v", rec)
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,7 +31,12 @@ const (
 	mp4                   = ".mp4"
 	mp3                   = ".mp3"
 	jpg                   = ".jpg"
+	m4a                   = ".m4a"
+	ogg                   = ".ogg"
+	flac                  = ".flac"
 	telegramUrl           = "https://api.telegram.org/bot"
+	telegramFileUrl       = "https://api.telegram.org/file/bot"
+	limitGetFile          = int64(20000000) // download limit of Bot API getFile
 	DisableNotification   = "/mute"
 	Start                 = "start"
 	Subscribe             = "subscribe"
@@ -49,6 +55,7 @@ const (
 	sortinfoParamComplete = "sort_list_done"
 	saveinfoParamComplete = "save_list_done"
 	paramTypeVideo        = "atype"
+	paramFormat           = "aformat"
 	paramLink             = "linkonly"
 	paramGood             = "+++"
 	infoLabel             = "⚠"
@@ -57,14 +64,43 @@ const (
 
 	delimeterString = "--!--"
 
-	commandCancel        = "!!!cancel!!!"
-	commandStart         = "start"
-	commandStartConfirm  = "!!!start_confirm_good!!!"
-	commandType          = "!!!type!!!"
-	commandFind          = "!!!find!!!"
-	commandDeleteCurrent = "!!!delthis!!!"
-	commandSettingsJpg   = "!!!front_picture!!!"
-	commandSettingsLog   = "!!!logs!!!"
+	commandCancel           = "!!!cancel!!!"
+	commandStart            = "start"
+	commandStartConfirm     = "!!!start_confirm_good!!!"
+	commandType             = "!!!type!!!"
+	commandFormat           = "!!!format!!!"
+	commandFind             = "!!!find!!!"
+	commandDeleteCurrent    = "!!!delthis!!!"
+	commandSettingsJpg      = "!!!front_picture!!!"
+	commandSettingsLog      = "!!!logs!!!"
+	commandSettingsAlbum    = "!!!album!!!"
+	commandSettingsChapters = "!!!chapters!!!"
+	commandSort             = "!!!sort!!!"
+	commandPreview          = "!!!preview!!!"
+
+	commandAdminUsers     = "users"
+	commandAdminBan       = "ban"
+	commandAdminUnban     = "unban"
+	commandAdminKick      = "kick"
+	commandAdminBroadcast = "broadcast"
+	commandAdminJobs      = "jobs"
+	commandAdminHelp      = "admin"
+	paramBanned           = "banned"
+	commandRules          = "rules"
+	commandNameTemplate   = "filename"
+	commandFilters        = "filters"
+	commandLimits         = "limits"
+	commandAdminInvite    = "invite"
+	commandAccessApprove  = "!!!access_ok!!!"
+	commandAccessDeny     = "!!!access_no!!!"
+	paramAccess           = "access"
+	paramAccessPending    = "access_pending"
+	paramAccessDenied     = "access_denied"
+	accessOpen            = "open"
+	accessAllowlist       = "allowlist"
+	accessInvite          = "invite"
+	accessApproval        = "approval"
+	broadcastDelay        = 100 * time.Millisecond
 
 	defaultWebHook = "get"
 
@@ -80,6 +116,10 @@ var (
 	api        = ""
 	debug      = false
 	usewebhook = false
+	admins     = map[int64]bool{}
+	accessMode = accessOpen
+	allowlist  = map[string]bool{}
+	captcha    = true
 )
 
 // defHandler(http.ResponseWriter, *http.Request, interface{})
@@ -184,13 +224,35 @@ func (obj *Action) getHandlerManual(val *Result, MainTasker *Tasker, cmds *Comma
 	tempMessage.ChatIDStr = sprintf("%d", tempMessage.ChatID)
 	tempMessage.LanguageCode = fmaxStr(&val.Message.From.LanguageCode, &val.CallbackQuery.From.LanguageCode)
 	tempMessage.UUID = replaceSpecialSymbols(uuid.New().String())
+	tempMessage.Reply = replyMedia(val)
+	tempMessage.Upload = uploadMedia(val)
+	if command == "" && tempMessage.Upload.FileID != "" {
+		// file or photo without text, caption sets tags
+		command = strings.TrimSpace("/" + commandUpload + " " + val.Message.Caption)
+	}
+	if sBool(user.getParameter(paramParam, paramBanned)) && !user.isAdmin() {
+		return
+	}
+	user.touch(user.Name)
+	if strings.HasPrefix(command, "/"+commandFormats+" ") {
+		// link is argument of picker, not a download
+		command = "/" + commandFormats + " " + formatsLinkID(strings.TrimPrefix(command, "/"+commandFormats))
+	}
 	re := regexp.MustCompile(`.+(watch\?v=|youtu.be/)`)
 	command = re.ReplaceAllString(command, commandFind)
 	re = regexp.MustCompile(`.+playlist\?list=`)
 	command = re.ReplaceAllString(command, commandFind)
 	if strings.HasPrefix(command, commandFind) {
 		re = regexp.MustCompile(`[a-zA-Z0-9_-]{11,41}`)
-		command = commandFind + re.FindString(command)
+		link, selector, _ := strings.Cut(command, " ")
+		id := re.FindString(link)
+		command = commandFind + id
+		if len(id) <= 12 {
+			selector = clipSelector(link, strings.TrimSpace(selector))
+		}
+		if selector = strings.TrimSpace(selector); selector != "" {
+			command += " " + selector
+		}
 	}
 	if strings.HasPrefix(command, commandType) {
 		re = regexp.MustCompile(`[0-9]{1,4}`)
@@ -212,6 +274,9 @@ func (obj *Action) getHandlerManual(val *Result, MainTasker *Tasker, cmds *Comma
 		case "18":
 			typetext_ = "low (360p)"
 			user.setParameter(paramParam, mp3, false)
+		case "480", "720", "1080", "1440":
+			typetext_ = "HD " + type_ + "p (adaptive)"
+			user.setParameter(paramParam, mp3, false)
 		default:
 			typetext_ = "/settingsQuality"
 			if !sBool(user.getParameter(paramParam, paramLink)) {
@@ -237,16 +302,16 @@ func (obj *Action) getHandlerManual(val *Result, MainTasker *Tasker, cmds *Comma
 	tempMessage.ParseMode = htmlMode
 	tempMessage.DelAfterDelay = 5 * time.Second
 	ok := false
-	switch command {
-	case "/" + commandStartConfirm:
+	switch {
+	case command == "/"+commandStartConfirm:
 		tempMessage.ReplyMarkup = cmds.B.Return()
 		ok = true
-	case "/" + commandStart:
+	case command == "/"+commandStart || strings.HasPrefix(command, "/"+commandStart+" "):
 		tempMessage.ReplyMarkup = Buttons{}
 		ok = true
 	default:
 		tempMessage.ReplyMarkup = Buttons{}
-		ok = sBool(user.getParameter(paramParam, Subscribe))
+		ok = sBool(user.getParameter(paramParam, Subscribe)) && user.accessAllowed() || user.isAdmin()
 	}
 	cmdss := cmds.Find(command)
 	if cmdss.IsCommand {
@@ -289,6 +354,17 @@ func main() {
 	// os.Setenv("DEBUG", "0")
 	// os.Setenv("WEBHOOK", "0")
 	// os.Setenv("HOST", "xxxXXXxxx")
+	// os.Setenv("ADMINS", "123456789,987654321")
+	// os.Setenv("ACCESS", "open") // open, allowlist, invite, approval
+	// os.Setenv("ALLOWLIST", "123456789,@username")
+	// os.Setenv("CAPTCHA", "1")
+	// os.Setenv("REGION", "DE") // country for 'skip blocked' filter
+	// os.Setenv("LOUDNESS_TARGET", "-16") // LUFS of loudness normalization
+	// os.Setenv("QUOTA_DAY_TRACKS", "0") // also QUOTA_DAY_MB, QUOTA_DAY_MINUTES, QUOTA_MONTH_*, QUOTA_JOBS. 0 - unlimited
+	// Database maintenance, bot must be stopped: tv_mess db <command>
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		os.Exit(dbTool(os.Args[2:]))
+	}
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	runtime.LockOSThread()
 	runtime.Gosched()
@@ -307,13 +383,23 @@ func main() {
 	api = os.Getenv("TAPI")
 	debug = os.Getenv("DEBUG") == "1"
 	usewebhook = os.Getenv("WEBHOOK") == "1"
+	admins = parseAdmins(os.Getenv("ADMINS"))
+	accessMode = parseAccessMode(os.Getenv("ACCESS"))
+	if err := checkAccessMode(accessMode, admins); err != nil {
+		log.Fatal(err)
+	}
+	allowlist = parseAllowlist(os.Getenv("ALLOWLIST"))
+	captcha = os.Getenv("CAPTCHA") != "0"
+	quotaLimits = parseQuotaLimits()
+	region = strings.ToUpper(os.Getenv("REGION"))
+	loudnessTarget = parseLoudnessTarget(os.Getenv("LOUDNESS_TARGET"))
 	MainTasker := new(Tasker).Init(runtime.NumCPU(), taskscount)
 	playlistQ :=
 		resource +
 			"playlistItems" + startDelimeter +
 			"key=" + yt3key + delimeter +
 			"playlistId=" + "%s" + delimeter +
-			"part=contentDetails" + delimeter +
+			"part=snippet,contentDetails" + delimeter +
 			"maxResults=" + maxResults + delimeter +
 			"pageToken="
 	videoQ :=
@@ -322,13 +408,20 @@ func main() {
 			"key=" + yt3key + delimeter +
 			"id=" + "%s" + delimeter +
 			"part=snippet,contentDetails"
+	playlistInfoQ :=
+		resource +
+			"playlists" + startDelimeter +
+			"key=" + yt3key + delimeter +
+			"id=" + "%s" + delimeter +
+			"part=snippet"
 	obj := new(Action)
+	obj.Jobs = new(JobList).Init()
+	obj.Previews = new(PreviewList).Init()
 	obj.Db = new(DataBase)
-	path, err := filepath.Abs(filepath.Dir(os.Args[0]))
-	if err != nil {
-		toLog(err)
+	obj.Db.Open(databaseDefaultPath())
+	if obj.Db.Err != nil {
+		log.Fatal(obj.Db.Err)
 	}
-	obj.Db.Open(filepath.Join(path, databasename))
 	defer obj.Db.Close()
 	markCurrent := func(user *botUser, key_ string, list map[string]string) map[string]string {
 		newlist := make(map[string]string)
@@ -348,7 +441,27 @@ func main() {
 	cmds := new(Commands).DbConnect(obj.Db)
 	cmds.B = new(Buttons)
 	cmds.AddNewLine()
+	subscribe := func(message Message, usr *botUser) {
+		usr.setParameter(paramParam, Subscribe, true)
+		usr.setParameter(paramParam, mp4, true)
+		usr.setParameter(paramParam, mp3, true)
+		usr.setParameter(paramParam, commandSettingsLog, false)
+		usr.setParameter(paramParam, paramTypeVideo, "140")
+		usr.setParameter(paramParam, jpg, false)
+		usr.setParameter(paramParam, "add_log", false)
+		message.Text = message.tr("Hello! You are subscribe. Paste link to playlist/song, selectors like 'last 10' can follow playlist link (/filters). Or you can use the buttons below ↓. Do not delete this message, otherwise you may delete buttons below.")
+		message.MessageId = -1
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	}
 	cmds.Add(commandStart, "🆗start", false, false, func(message Message, usr *botUser) {
+		if !obj.startAccess(message, usr, MainTasker) {
+			return
+		}
+		if !captcha {
+			message.ReplyMarkup = cmds.B.Return()
+			subscribe(message, usr)
+			return
+		}
 		message.DelAfter = true
 		message.DelAfterDelay = 10 * time.Second
 		MainTasker.Add(nil, message.SendRandomWrapperTask, &message)
@@ -369,19 +482,13 @@ func main() {
 		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
 	})
 	cmds.Add(commandStartConfirm, "🆗start confirm good", false, false, func(message Message, usr *botUser) {
-		usr.setParameter(paramParam, Subscribe, true)
-		usr.setParameter(paramParam, mp4, true)
-		usr.setParameter(paramParam, mp3, true)
-		usr.setParameter(paramParam, commandSettingsLog, false)
-		usr.setParameter(paramParam, paramTypeVideo, "140")
-		usr.setParameter(paramParam, jpg, false)
-		usr.setParameter(paramParam, "add_log", false)
-		message.Text = message.tr("Hello! You are subscribe. Paste link to playlist/song. Or you can use the buttons below ↓. Do not delete this message, otherwise you may delete buttons below.")
-		message.MessageId = -1
-		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+		if !usr.accessAllowed() {
+			return
+		}
+		subscribe(message, usr)
 	})
 	cmds.Add("settingsQuality", "⚙Quality", true, true, func(message Message, usr *botUser) {
-		message.Text = message.tr("🎵 Choose video/audio quality type")
+		message.Text = message.tr("🎵 Choose video/audio quality type and audio format") + "\n/" + commandQuality + " - " + message.tr("fallback if quality is missing")
 		message.DelBefore = true
 		versions := make(map[string]string)
 		versions[message.tr("high (audio)")] = commandType + "251"
@@ -389,15 +496,45 @@ func main() {
 		versions[message.tr("low (audio)")] = commandType + "249"
 		versions[message.tr("medium (720p)")] = commandType + "22"
 		versions[message.tr("low (360p)")] = commandType + "18"
+		for _, h := range videoResolutions {
+			versions["HD "+h+"p"] = commandType + h
+		}
 		if !sBool(usr.getParameter(paramParam, paramLink)) {
 			versions[message.tr("🔴 link mode")] = commandType + paramLink
 		} else {
 			versions[message.tr("🟢 link mode")] = commandType + paramLink
 		}
+		current := usr.audioFormat()
+		for _, f := range audioFormats {
+			if f.Name == current.Name && sBool(usr.getParameter(paramParam, mp3)) {
+				versions["🎧 "+f.Title] = commandFormat + f.Name
+			} else {
+				versions[f.Title] = commandFormat + f.Name
+			}
+		}
 		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
 		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(markCurrent(usr, paramTypeVideo, versions))}
 		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
 	})
+	cmds.Add(commandFormat, commandFormat, false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		format := findAudioFormat(strings.TrimPrefix(message.Command, commandFormat))
+		usr.setParameter(paramParam, paramFormat, format.Name)
+		usr.setParameter(paramParam, paramLink, false)
+		usr.setParameter(paramParam, mp4, true)
+		usr.setParameter(paramParam, mp3, true)
+		switch {
+		case format.Itag != 0:
+			// source stream with same codec, file is remuxed without re-encoding
+			usr.setParameter(paramParam, paramTypeVideo, sprintf("%d", format.Itag))
+		case !isAudioItag(usr.getParameter(paramParam, paramTypeVideo)):
+			usr.setParameter(paramParam, paramTypeVideo, "140")
+		}
+		message.Text = message.tr("You are choosing - ") + format.Title
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
 	cmds.Add(commandType, commandType, false, false, func(message Message, usr *botUser) {
 		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
 		text := strings.TrimPrefix(message.Command, commandType)
@@ -425,7 +562,96 @@ func main() {
 		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
 		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(markCurrent(usr, commandSettingsLog, versions))}
 		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("settings4", "⚙ALBUM", true, true, func(message Message, usr *botUser) {
+		message.Text = message.tr("💿 Do you want playlists as albums? Tracks keep playlist order, get playlist title as album and one cover, and are sent in groups. Works with audio conversion.")
+		message.DelBefore = true
+		versions := make(map[string]string)
+		versions[message.tr("➕ album")] = "/+++" + commandSettingsAlbum
+		versions[message.tr("➖ album")] = "/---" + commandSettingsAlbum
+		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(markCurrent(usr, commandSettingsAlbum, versions))}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("settings6", "⚙CHAPTERS", true, true, func(message Message, usr *botUser) {
+		message.Text = message.tr("📑 Do you want long videos cut by chapters? Chapters are taken from description timestamps or video markers, every chapter is sent as separate tagged track. Works with audio conversion.")
+		message.DelBefore = true
+		versions := make(map[string]string)
+		versions[message.tr("➕ chapters")] = "/+++" + commandSettingsChapters
+		versions[message.tr("➖ chapters")] = "/---" + commandSettingsChapters
+		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(markCurrent(usr, commandSettingsChapters, versions))}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("settings7", "⚙LOUDNESS", true, true, func(message Message, usr *botUser) {
+		message.Text = message.tr("🔊 Do you want equal loudness of tracks? Normalization re-encodes audio to one loudness, ReplayGain only writes gain tags for players. Works with audio conversion.")
+		message.DelBefore = true
+		current := usr.loudnessMode()
+		versions := make(map[string]string)
+		for _, mode := range loudnessModes {
+			if mode == current {
+				versions["👉 "+message.tr(loudnessTitles[mode])] = "/" + commandLoudness + mode
+			} else {
+				versions[message.tr(loudnessTitles[mode])] = "/" + commandLoudness + mode
+			}
+		}
+		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(versions)}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add(commandLoudness, "⚙loudness", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		mode := strings.TrimPrefix(message.Command, "/"+commandLoudness)
+		if !slices.Contains(loudnessModes, mode) {
+			return
+		}
+		usr.setParameter(paramParam, paramLoudness, mode)
+		message.Text = message.tr("You are choosing - ") + message.tr(loudnessTitles[mode])
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("settings5", "⚙SORT", true, true, func(message Message, usr *botUser) {
+		message.Text = message.tr("🔃 Choose order of playlist files and logs")
+		message.DelBefore = true
+		by, reverse := usr.sortMode()
+		versions := make(map[string]string)
+		for _, mode := range sortModes {
+			if mode == by {
+				versions["👉 "+message.tr(sortTitles[mode])] = "/" + commandSort + mode
+			} else {
+				versions[message.tr(sortTitles[mode])] = "/" + commandSort + mode
+			}
+		}
+		if reverse {
+			versions["👉 "+message.tr("🔁 reverse")] = "/" + commandSort + paramSortReverse
+		} else {
+			versions[message.tr("🔁 reverse")] = "/" + commandSort + paramSortReverse
+		}
+		versions[message.tr("❌ close")] = "/" + commandDeleteCurrent
+		message.ReplyMarkup = Button{InlineKeyboard: buttomsMap(versions)}
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
 	}).AddNewLine()
+	cmds.Add(commandSort, "⚙sort", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		mode := strings.TrimPrefix(message.Command, "/"+commandSort)
+		switch {
+		case mode == paramSortReverse:
+			usr.turnParameter(paramParam, paramSortReverse)
+		case slices.Contains(sortModes, mode):
+			usr.setParameter(paramParam, paramSort, mode)
+		default:
+			return
+		}
+		by, reverse := usr.sortMode()
+		message.Text = message.tr("You are choosing - ") + message.tr(sortTitles[by])
+		if reverse {
+			message.Text += " (" + message.tr("reverse") + ")"
+		}
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
 	cmds.Add(commandCancel, "⚙cancel", true, false, func(message Message, usr *botUser) {
 		message.UUID = strings.TrimPrefix(message.Command, "/"+commandCancel)
 		tttt := GetCtx[*BranchContext](MainTasker, "context", &message)
@@ -471,6 +697,43 @@ func main() {
 		message.DelAfter = true
 		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
 	})
+	cmds.Add("+++"+commandSettingsAlbum, "⚙add album", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		usr.setParameter(paramParam, commandSettingsAlbum, true)
+		message.Text = message.tr("You are choosed playlists as albums")
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("---"+commandSettingsAlbum, "⚙no add album", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		usr.setParameter(paramParam, commandSettingsAlbum, false)
+		message.Text = message.tr("You are choosed playlists as separate tracks")
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("+++"+commandSettingsChapters, "⚙add chapters", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		usr.setParameter(paramParam, commandSettingsChapters, true)
+		message.Text = message.tr("You are choosed long videos by chapters")
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("---"+commandSettingsChapters, "⚙no add chapters", false, false, func(message Message, usr *botUser) {
+		MainTasker.Add(message.Cbmid, message.DeleteMessageWrapperTask, &message)
+		usr.setParameter(paramParam, commandSettingsChapters, false)
+		message.Text = message.tr("You are choosed long videos as one file")
+		message.DelBefore = true
+		message.DelAfter = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
+	cmds.Add("quota", "📊quota", false, true, func(message Message, usr *botUser) {
+		message.Text = usr.quotaText(&message)
+		message.DelBefore = true
+		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+	})
 	cmds.Add("cthulu", "🐙cthulu", true, false, func(message Message, usr *botUser) {
 		message.Text = "🐙Ph'nglui mglw'nafh Cthulhu R'lyeh wgah'nagl fhtagn"
 		message.DelBefore = true
@@ -503,9 +766,39 @@ func main() {
 		MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
 	})
 	cmds.Add(commandFind, commandFind, false, false, func(message Message, usr *botUser) {
-		playlist := strings.TrimPrefix(message.Command, commandFind)
+		playlist, selector, _ := strings.Cut(strings.TrimPrefix(message.Command, commandFind), " ")
+		var filter *PlaylistFilter
+		var clip *ClipRange
+		var itag int
+		var err error
+		help := filterHelp
+		if len(playlist) > 12 {
+			filter, err = parsePlaylistFilter(selector)
+		} else {
+			itag, selector = cutItag(selector)
+			clip, err = parseClip(selector)
+			help = clipHelp
+		}
+		if err != nil {
+			message.Text = infoLabel + html.EscapeString(err.Error()) + "\n\n" + help
+			message.DelBefore = true
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
 		MainTaskerT := new(Tasker).Init(runtime.NumCPU(), taskscount)
 		message.AddCtx(MainTaskerT, "user", usr)
+		limit := quotaLimits.Jobs
+		if usr.isAdmin() {
+			limit = 0
+		}
+		if _, ok := obj.Jobs.TryStart(&message, usr, playlist, MainTaskerT, limit); !ok {
+			MainTaskerT.Branch.Cancel()
+			message.Text = infoLabel + message.tr("Too many jobs at once. Wait for current downloads or cancel them.")
+			message.DelAfter = true
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+			return
+		}
+		defer obj.Jobs.Done(message.UUID)
 		time_ := time.Now().Format("2006_01_02_15_04_05")
 		message.AddCtx(MainTaskerT, "uuid", message.UUID)
 		message.AddCtx(MainTaskerT, mp3, sBool(usr.getParameter(paramParam, mp3)))
@@ -513,6 +806,9 @@ func main() {
 		usr.setParameter(paramParam, "uuid", message.UUID)
 		go func() {
 			GetCtx[bool](MainTaskerT, saveinfoParamComplete, &message)
+			if existFile(message.UUID+`\`+usr.Name+"_"+time_+".json") == "" {
+				return // cancelled before start
+			}
 			param := DocumentMessage{}
 			param.Src = message.UUID + `\` + usr.Name + "_" + time_ + ".json"
 			param.Check = sBool(usr.getParameter(paramParam, commandSettingsLog))
@@ -523,7 +819,13 @@ func main() {
 		tmp.M = new(sync.RWMutex)
 		tmp.playlistQ = playlistQ
 		tmp.videoQ = videoQ
+		tmp.playlistInfoQ = playlistInfoQ
 		tmp.Playlists = strings.Split(playlist, ";")
+		tmp.Hold = len(playlist) > 12
+		tmp.Filter = filter.merge(usr.defaultFilter())
+		tmp.Clip = clip
+		tmp.Itag = itag
+		tmp.Confirm = obj.previewConfirm(tmp, usr)
 		message.AddCtx(MainTasker, "context", &MainTaskerT.Branch)
 		if len(playlist) > 12 {
 			tmp.GetInformationPlaylist(MainTaskerT, &message)
@@ -531,8 +833,20 @@ func main() {
 			tmp.GetInformationVideo(MainTaskerT, playlist, &message)
 		}
 		MainTaskerT.Wg.Wait()
+		tmp.refundFailed(usr)
 		MainTaskerT.Branch.Cancel()
 	})
+	obj.addAdminCommands(cmds, MainTasker)
+	obj.addAccessCommands(cmds, MainTasker)
+	obj.addTitleRuleCommands(cmds, MainTasker)
+	obj.addNameTemplateCommands(cmds, MainTasker)
+	obj.addPreviewCommands(cmds, MainTasker)
+	obj.addFilterCommands(cmds, MainTasker)
+	obj.addClipCommands(cmds, MainTasker)
+	obj.addQualityCommands(cmds, MainTasker)
+	obj.addCoverCommands(cmds, MainTasker)
+	obj.addTagCommands(cmds, MainTasker)
+	obj.addUploadCommands(cmds, MainTasker)
 	// Will activate webhook or delete, if not using.
 	setWebHook(os.Getenv("HOST"), !usewebhook)
 	mux.HandleFunc("/"+defaultWebHook, extHandler(getHandler, []any{MainTasker, cmds, err, obj}))
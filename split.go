@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// splitMargin - part is planned smaller than limit, bitrate is not constant
+	splitMargin = 0.9
+	// splitWindow - how far from planned boundary silence or keyframe is searched
+	splitWindow = 15 * time.Second
+	// maxSplitParts - more parts are not tried
+	maxSplitParts = 50
+	silenceNoise  = "-35dB"
+)
+
+var reSilence = regexp.MustCompile(`silence_(start|end): (-?[\d.]+)`)
+
+// splitCount(int64, int64) int
+// planned count of parts
+func splitCount(size, limit int64) int {
+	n := int(math.Ceil(float64(size) / (float64(limit) * splitMargin)))
+	if n < 2 {
+		return 2
+	}
+	return n
+}
+
+// splitPoints(time.Duration, int, []time.Duration, time.Duration) []time.Duration
+// boundaries of n equal parts (first 0, last total), moved to nearest candidate in window
+func splitPoints(total time.Duration, n int, candidates []time.Duration, window time.Duration) []time.Duration {
+	points := []time.Duration{0}
+	for k := 1; k < n; k++ {
+		target := total * time.Duration(k) / time.Duration(n)
+		best, found := target, false
+		for _, c := range candidates {
+			if c <= points[len(points)-1] || c >= total || (c-target).Abs() > window {
+				continue
+			}
+			if !found || (c-target).Abs() < (best-target).Abs() {
+				best, found = c, true
+			}
+		}
+		points = append(points, best)
+	}
+	return append(points, total)
+}
+
+// parseSilence(string) []time.Duration
+// middles of silences from silencedetect output
+func parseSilence(out string) []time.Duration {
+	var ret []time.Duration
+	start := -1.0
+	for _, m := range reSilence.FindAllStringSubmatch(out, -1) {
+		sec, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		if m[1] == "start" {
+			start = math.Max(sec, 0)
+			continue
+		}
+		if start >= 0 {
+			ret = append(ret, time.Duration((start+sec)/2*float64(time.Second)))
+			start = -1
+		}
+	}
+	return ret
+}
+
+// partTitle(string, int, int) string
+// title of split part
+func partTitle(title string, k, n int) string {
+	return sprintf("%s (Part %d/%d)", title, k, n)
+}
+
+// maxFileSize([]string) int64
+// size of biggest file
+func maxFileSize(files []string) int64 {
+	var ret int64
+	for _, f := range files {
+		ret = max(ret, fileSize(f))
+	}
+	return ret
+}
+
+// removeFiles([]string)
+// delete temporary files
+func removeFiles(files []string) {
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
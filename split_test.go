@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_splitCount(t *testing.T) {
+	for _, tt := range []struct {
+		size, limit int64
+		want        int
+	}{
+		{46, 45, 2},
+		{80, 45, 2},
+		{90, 45, 3},
+		{200, 45, 5},
+	} {
+		if got := splitCount(tt.size, tt.limit); got != tt.want {
+			t.Errorf("splitCount(%d, %d) = %d, want %d", tt.size, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func Test_splitPoints(t *testing.T) {
+	s := func(sec float64) time.Duration { return time.Duration(sec * float64(time.Second)) }
+	for _, tt := range []struct {
+		name       string
+		total      time.Duration
+		n          int
+		candidates []time.Duration
+		want       []time.Duration
+	}{
+		{"no candidates", s(300), 3, nil, []time.Duration{0, s(100), s(200), s(300)}},
+		{"nearest in window", s(300), 2, []time.Duration{s(140), s(155), s(160), s(175)}, []time.Duration{0, s(155), s(300)}},
+		{"out of window", s(300), 2, []time.Duration{s(100), s(200)}, []time.Duration{0, s(150), s(300)}},
+		{"keeps order", s(40), 4, []time.Duration{s(9)}, []time.Duration{0, s(9), s(20), s(30), s(40)}},
+	} {
+		if got := splitPoints(tt.total, tt.n, tt.candidates, splitWindow); sprintf("%v", got) != sprintf("%v", tt.want) {
+			t.Errorf("%s: splitPoints() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_parseSilence(t *testing.T) {
+	out := `[silencedetect @ 0x1] silence_start: -0.01
+[silencedetect @ 0x1] silence_end: 1.5 | silence_duration: 1.51
+size=N/A time=00:01:00.00
+[silencedetect @ 0x1] silence_start: 59.2
+[silencedetect @ 0x1] silence_end: 60.2 | silence_duration: 1
+[silencedetect @ 0x1] silence_start: 100`
+	want := []time.Duration{750 * time.Millisecond, 59700 * time.Millisecond}
+	if got := parseSilence(out); sprintf("%v", got) != sprintf("%v", want) {
+		t.Errorf("parseSilence() = %v, want %v", got, want)
+	}
+}
+
+func Test_partTitle(t *testing.T) {
+	if got := partTitle("Artist [Song]", 2, 3); got != "Artist [Song] (Part 2/3)" {
+		t.Errorf("partTitle() = %q", got)
+	}
+}
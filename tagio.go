@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tagVendor - vendor string of vorbis comments written by bot
+const tagVendor = "tv_mess"
+
+// readFileTags(string) (map[string]string, []byte, error)
+// tags in keys of trackTags and cover of audio file, format by extension
+func readFileTags(path string) (map[string]string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case mp3:
+		return readID3(data)
+	case m4a, mp4:
+		return readMP4Tags(data)
+	case ogg:
+		return readOggTags(data)
+	case flac:
+		return readFlacTags(data)
+	default:
+		return nil, nil, errors.New("tags are not supported for " + ext)
+	}
+}
+
+// writeFileTags(string, map[string]string, []byte) error
+// replace all tags and cover of audio file without re-encoding, nil cover - file without cover
+func writeFileTags(path string, tags map[string]string, cover []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case mp3:
+		out, err = writeID3(data, tags, cover)
+	case m4a, mp4:
+		out, err = writeMP4Tags(data, tags, cover)
+	case ogg:
+		out, err = writeOggTags(data, tags, cover)
+	case flac:
+		out, err = writeFlacTags(data, tags, cover)
+	default:
+		err = errors.New("tags are not supported for " + ext)
+	}
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tags"
+	if err := os.WriteFile(tmp, out, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateFileTags(string, map[string]string) error
+// change some tags, other tags and cover are kept, empty value removes tag
+func updateFileTags(path string, set map[string]string) error {
+	tags, cover, err := readFileTags(path)
+	if err != nil {
+		return err
+	}
+	for k, v := range set {
+		if v == "" {
+			delete(tags, k)
+		} else {
+			tags[k] = v
+		}
+	}
+	return writeFileTags(path, tags, cover)
+}
+
+// writeTrackTags(string, map[string]string, string) error
+// replace tags of converted file, cover is taken from picture file if it exists
+func writeTrackTags(path string, tags map[string]string, coverPath string) error {
+	cover, err := os.ReadFile(coverPath)
+	if err != nil {
+		cover = nil
+	}
+	return writeFileTags(path, tags, cover)
+}
+
+// sortedKeys(map[string]string) []string
+// keys in stable order, files with same tags are equal
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitTrack(string) (int, int)
+// track and total from "3/10"
+func splitTrack(val string) (int, int) {
+	n, total, _ := strings.Cut(val, "/")
+	track, _ := strconv.Atoi(strings.TrimSpace(n))
+	count, _ := strconv.Atoi(strings.TrimSpace(total))
+	return track, count
+}
+
+// joinTrack(int, int) string
+// track in format of trackTags
+func joinTrack(track, total int) string {
+	if total > 0 {
+		return strconv.Itoa(track) + "/" + strconv.Itoa(total)
+	}
+	return strconv.Itoa(track)
+}
+
+// coverMime([]byte) string
+// mime type of cover by signature
+func coverMime(cover []byte) string {
+	if bytes.HasPrefix(cover, []byte("\x89PNG")) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testCover(*testing.T) []byte
+// small JPEG for covers of synthetic files
+func testCover(t *testing.T) []byte {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// syntheticMP3() []byte
+// old ID3v2.3 tag with UTF-16 title and frames of silence
+func syntheticMP3() []byte {
+	title := []byte{1, 0xff, 0xfe, 'O', 0, 'l', 0, 'd', 0}
+	frame := append([]byte("TIT2"), binary.BigEndian.AppendUint32(nil, uint32(len(title)))...)
+	frame = append(append(frame, 0, 0), title...)
+	ret := append([]byte("ID3\x03\x00\x00"), syncsafe(len(frame))...)
+	ret = append(ret, frame...)
+	return append(ret, bytes.Repeat([]byte("\xff\xfb\x90\x00"), 64)...)
+}
+
+// syntheticFlac() []byte
+// STREAMINFO, padding and fake frames
+func syntheticFlac() []byte {
+	ret := []byte("fLaC\x00\x00\x00\x22")
+	ret = append(ret, make([]byte, 34)...)
+	ret = append(ret, 0x81, 0, 0, 16)
+	ret = append(ret, make([]byte, 16)...)
+	return append(ret, bytes.Repeat([]byte("\xff\xf8audio"), 32)...)
+}
+
+// syntheticOpus() []byte
+// OpusHead, OpusTags and two audio pages
+func syntheticOpus() []byte {
+	comment, _ := marshalVorbisComment("test", map[string]string{"title": "Old"}, nil)
+	head := oggPage{Type: 2, Serial: 7, Sequence: 0, Lacing: []byte{19}, Body: append([]byte("OpusHead\x01\x02"), make([]byte, 9)...)}
+	tags := append([]byte("OpusTags"), comment...)
+	var ret []byte
+	ret = append(ret, head.bytes()...)
+	ret = append(ret, oggPage{Serial: 7, Sequence: 1, Lacing: []byte{byte(len(tags))}, Body: tags}.bytes()...)
+	ret = append(ret, oggPage{Serial: 7, Sequence: 2, Granule: 960, Lacing: []byte{5}, Body: []byte("audio")}.bytes()...)
+	return append(ret, oggPage{Type: 4, Serial: 7, Sequence: 3, Granule: 1920, Lacing: []byte{5}, Body: []byte("final")}.bytes()...)
+}
+
+// syntheticM4a(bool) []byte
+// ftyp, moov with chunk offsets to mdat and mdat, moov is first for faststart
+func syntheticM4a(faststart bool) []byte {
+	payload := []byte("chunk-1.chunk-2.")
+	stco := func(base int) []byte {
+		body := []byte{0, 0, 0, 0, 0, 0, 0, 2}
+		body = binary.BigEndian.AppendUint32(body, uint32(base))
+		body = binary.BigEndian.AppendUint32(body, uint32(base+8))
+		return mp4Box("moov", mp4Box("mvhd", make([]byte, 100)),
+			mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", mp4Box("stco", body))))),
+			mp4Box("udta", mp4Box("name", []byte("keep"))))
+	}
+	ftyp := mp4Box("ftyp", []byte("M4A \x00\x00\x02\x00isomM4A "))
+	mdat := mp4Box("mdat", payload)
+	if faststart {
+		size := len(stco(0))
+		return bytes.Join([][]byte{ftyp, stco(len(ftyp) + size + 8), mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, stco(len(ftyp) + 8)}, nil)
+}
+
+// m4aChunks(*testing.T, []byte) []string
+// data of chunks by stco offsets
+func m4aChunks(t *testing.T, data []byte) []string {
+	pos := bytes.Index(data, []byte("stco"))
+	if pos < 0 {
+		t.Fatal("no stco")
+	}
+	var ret []string
+	for k := 0; k < 2; k++ {
+		offset := int(binary.BigEndian.Uint32(data[pos+12+4*k:]))
+		ret = append(ret, string(data[offset:offset+8]))
+	}
+	return ret
+}
+
+func Test_fileTagsRoundTrip(t *testing.T) {
+	cover := testCover(t)
+	tags := map[string]string{"title": "Песня", "artist": "Artist", "album": "Album", "date": "2021", "track": "3/12",
+		"comment": "https://www.youtube.com/watch?v=abc123", tagVideoID: "abc123", "REPLAYGAIN_TRACK_GAIN": "-2.50 dB"}
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name  string
+		data  []byte
+		title string
+	}{
+		{"track.mp3", syntheticMP3(), "Old"},
+		{"track.flac", syntheticFlac(), ""},
+		{"track.ogg", syntheticOpus(), "Old"},
+		{"faststart.m4a", syntheticM4a(true), ""},
+		{"track.m4a", syntheticM4a(false), ""},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		old, _, err := readFileTags(path)
+		if err != nil || old["title"] != tt.title {
+			t.Errorf("%s: old tags = %v, %v", tt.name, old, err)
+		}
+		if err := writeFileTags(path, tags, cover); err != nil {
+			t.Errorf("%s: writeFileTags() error = %v", tt.name, err)
+			continue
+		}
+		got, gotCover, err := readFileTags(path)
+		if err != nil {
+			t.Errorf("%s: readFileTags() error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tags) || !bytes.Equal(gotCover, cover) {
+			t.Errorf("%s: tags = %v, cover %d bytes", tt.name, got, len(gotCover))
+		}
+		if err := updateFileTags(path, map[string]string{"title": "New", "REPLAYGAIN_TRACK_GAIN": ""}); err != nil {
+			t.Errorf("%s: updateFileTags() error = %v", tt.name, err)
+			continue
+		}
+		got, gotCover, _ = readFileTags(path)
+		if got["title"] != "New" || got["artist"] != "Artist" || got["REPLAYGAIN_TRACK_GAIN"] != "" || !bytes.Equal(gotCover, cover) {
+			t.Errorf("%s: updated tags = %v", tt.name, got)
+		}
+		data, _ := os.ReadFile(path)
+		switch filepath.Ext(path) {
+		case m4a:
+			if chunks := m4aChunks(t, data); chunks[0] != "chunk-1." || chunks[1] != "chunk-2." {
+				t.Errorf("%s: chunks = %q", tt.name, chunks)
+			}
+			if !bytes.Contains(data, []byte("namekeep")) {
+				t.Errorf("%s: other udta atoms are lost", tt.name)
+			}
+		case mp3, flac:
+			if !bytes.HasSuffix(data, tt.data[len(tt.data)-64:]) {
+				t.Errorf("%s: audio is changed", tt.name)
+			}
+		case ogg:
+			pages, err := parseOggPages(data)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			last := pages[len(pages)-1]
+			if last.Type != 4 || last.Granule != 1920 || last.Sequence != uint32(len(pages)-1) || string(last.Body) != "final" {
+				t.Errorf("%s: last page = %+v", tt.name, last)
+			}
+		}
+	}
+}
+
+func Test_fileTagsErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"a.wav":  []byte("RIFF"),
+		"b.flac": []byte("fLaC\x80"),
+		"c.m4a":  mp4Box("ftyp", []byte("M4A ")),
+		"d.ogg":  []byte("OggS broken"),
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0666)
+		if err := writeFileTags(path, map[string]string{"title": "x"}, nil); err == nil {
+			t.Errorf("writeFileTags(%s) error = nil", name)
+		}
+		if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+			t.Errorf("writeFileTags(%s) changed broken file", name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strconv"
+)
+
+// tagVideoID - custom tag with YouTube video ID (TXXX frame in ID3v2)
+const tagVideoID = "YOUTUBE_ID"
+
+// trackTags(*JsonPls) map[string]string
+// metadata in ffmpeg generic keys. ffmpeg writes them as ID3v2.4 frames, MP4 atoms or vorbis comments
+func trackTags(v *JsonPls) map[string]string {
+	tags := map[string]string{
+		"title":        v.Song,
+		"artist":       v.Artist,
+		"album":        v.Album,
+		"album_artist": v.AlbumArtist,
+		"date":         v.Year,
+		"genre":        v.Genre,
+		"publisher":    v.Label,
+		"composer":     v.Composer,
+		"comment":      v.URL,
+		tagVideoID:     v.ID,
+	}
+	if v.Date != "" {
+		tags["date"] = v.Date
+	}
+	if v.Track > 0 {
+		tags["track"] = strconv.Itoa(v.Track)
+		if v.TrackTotal > 0 {
+			tags["track"] += "/" + strconv.Itoa(v.TrackTotal)
+		}
+	}
+	for k, val := range tags {
+		if val == "" {
+			delete(tags, k)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_trackTags(t *testing.T) {
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Artist: "Artist", Song: "Song"}, Album: "Album", Year: "2021", Genre: "Music",
+		Track: 3, TrackTotal: 12, URL: "https://www.youtube.com/watch?v=abc123"}
+	want := map[string]string{"title": "Song", "artist": "Artist", "album": "Album", "date": "2021", "genre": "Music",
+		"track": "3/12", "comment": "https://www.youtube.com/watch?v=abc123", tagVideoID: "abc123"}
+	if got := trackTags(v); !reflect.DeepEqual(got, want) {
+		t.Errorf("trackTags() = %v, want %v", got, want)
+	}
+	got := trackTags(&JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Song: "Song"}})
+	if _, ok := got["track"]; ok || len(got) != 2 {
+		t.Errorf("single video tags = %v", got)
+	}
+}
+
+func Test_writeTrackTags(t *testing.T) {
+	dir := t.TempDir()
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Artist: "Artist", Song: "Song"}, Album: "Album", Year: "2021",
+		Track: 3, TrackTotal: 12, URL: "https://www.youtube.com/watch?v=abc123", URLSaved: filepath.Join(dir, "track")}
+	cover := testCover(t)
+	os.WriteFile(v.URLSaved+jpg, cover, 0666)
+	for _, ext := range []string{mp3, ogg, m4a} {
+		data := map[string][]byte{mp3: syntheticMP3(), ogg: syntheticOpus(), m4a: syntheticM4a(false)}[ext]
+		os.WriteFile(v.URLSaved+ext, data, 0666)
+		if err := writeTrackTags(v.URLSaved+ext, trackTags(v), v.URLSaved+jpg); err != nil {
+			t.Errorf("%s: writeTrackTags() error = %v", ext, err)
+			continue
+		}
+		got, gotCover, err := readFileTags(v.URLSaved + ext)
+		if err != nil || !reflect.DeepEqual(got, trackTags(v)) || !bytes.Equal(gotCover, cover) {
+			t.Errorf("%s: tags = %v, cover %d bytes, %v", ext, got, len(gotCover), err)
+		}
+	}
+}
+
+func Test_ConvertAudio_id3(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found")
+	}
+	dir := t.TempDir()
+	v := &JsonPls{JsonPlsMinimal: JsonPlsMinimal{ID: "abc123", Artist: "Artist", Song: "Song"}, Album: "Album", Year: "2021", Genre: "Music",
+		Track: 3, TrackTotal: 12, URL: "https://www.youtube.com/watch?v=abc123", URLSaved: filepath.Join(dir, "track")}
+	if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "sine=duration=1", "-c:a", "aac", v.URLSaved+mp4).Run(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(v.URLSaved + jpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil)
+	f.Close()
+	Tr := new(Tasker).Init(1, 8)
+	message := &Message{}
+	message.AddCtx(Tr, v.URLSaved+jpg, true)
+	message.AddCtx(Tr, v.URLSaved+mp4, true)
+	ConvertAudio(Tr, Thing{Input: v}, tryingDownload, findAudioFormat("mp3_128"), message)
+	got, cover, err := readFileTags(v.URLSaved + mp3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := trackTags(v); !reflect.DeepEqual(got, want) || len(cover) == 0 {
+		t.Errorf("tags = %v, cover %d bytes, want %v", got, len(cover), want)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -146,3 +147,98 @@ func (o *Tasker) Work() {
 		}
 	}
 }
+
+// Job - running user request (one link or playlist)
+type Job struct {
+	UUID    string
+	ChatID  int64
+	User    string
+	Link    string
+	Started time.Time
+	Tasker  *Tasker
+}
+
+// JobList - active jobs of all users
+type JobList struct {
+	Items map[string]*Job
+	M     *sync.RWMutex
+}
+
+// Init() *JobList
+// initialize JobList
+func (o *JobList) Init() *JobList {
+	o.Items = make(map[string]*Job)
+	o.M = &sync.RWMutex{}
+	return o
+}
+
+// Start(*Message, *botUser, string, *Tasker) *Job
+// register new active job
+func (o *JobList) Start(message *Message, usr *botUser, link string, T *Tasker) *Job {
+	job, _ := o.TryStart(message, usr, link, T, 0)
+	return job
+}
+
+// TryStart(*Message, *botUser, string, *Tasker, int) (*Job, bool)
+// register new active job if chat has less than limit jobs (0 - unlimited), check and start are atomic
+func (o *JobList) TryStart(message *Message, usr *botUser, link string, T *Tasker, limit int) (*Job, bool) {
+	o.M.Lock()
+	defer o.M.Unlock()
+	if limit > 0 {
+		n := 0
+		for _, v := range o.Items {
+			if v.ChatID == message.ChatID {
+				n++
+			}
+		}
+		if n >= limit {
+			return nil, false
+		}
+	}
+	job := &Job{UUID: message.UUID, ChatID: message.ChatID, User: usr.Name, Link: link, Started: time.Now(), Tasker: T}
+	o.Items[job.UUID] = job
+	return job, true
+}
+
+// Done(string)
+// remove finished job
+func (o *JobList) Done(uuid string) {
+	o.M.Lock()
+	delete(o.Items, uuid)
+	o.M.Unlock()
+}
+
+// List() []*Job
+// active jobs sorted by start time
+func (o *JobList) List() []*Job {
+	o.M.RLock()
+	jobs := make([]*Job, 0, len(o.Items))
+	for _, v := range o.Items {
+		jobs = append(jobs, v)
+	}
+	o.M.RUnlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+	return jobs
+}
+
+// ByChat(int64) []*Job
+// active jobs of one chat
+func (o *JobList) ByChat(chatID int64) []*Job {
+	var jobs []*Job
+	for _, v := range o.List() {
+		if v.ChatID == chatID {
+			jobs = append(jobs, v)
+		}
+	}
+	return jobs
+}
+
+// Cancel(int64) int
+// cancel all active jobs of chat. Return count of canceled
+func (o *JobList) Cancel(chatID int64) int {
+	jobs := o.ByChat(chatID)
+	for _, v := range jobs {
+		v.Tasker.Branch.Cancel()
+	}
+	return len(jobs)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"html"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -73,6 +75,21 @@ type Result struct {
 		ForwardFromMessageID int    `json:"forward_from_message_id"`
 		ForwardDate          int    `json:"forward_date"`
 		EditDate             int    `json:"edit_date"`
+		ReplyToMessage       struct {
+			MessageID int64 `json:"message_id"`
+			Audio     struct {
+				FileID    string `json:"file_id"`
+				FileName  string `json:"file_name"`
+				Performer string `json:"performer"`
+				Title     string `json:"title"`
+				FileSize  int64  `json:"file_size"`
+			} `json:"audio"`
+			Document struct {
+				FileID   string `json:"file_id"`
+				FileName string `json:"file_name"`
+				FileSize int64  `json:"file_size"`
+			} `json:"document"`
+		} `json:"reply_to_message"`
 		Text                 string `json:"text"`
 		Entities             []struct {
 			Type   string `json:"type"`
@@ -107,6 +124,7 @@ type Result struct {
 			Duration  int    `json:"duration"`
 			Performer string `json:"performer"`
 			Title     string `json:"title"`
+			FileName  string `json:"file_name"`
 			MimeType  string `json:"mime_type"`
 			FileSize  int    `json:"file_size"`
 		} `json:"audio"`
@@ -196,6 +214,7 @@ type Result struct {
 				Height   int    `json:"height"`
 				FileSize int    `json:"file_size"`
 			} `json:"thumb"`
+			FileName string `json:"file_name"`
 			MimeType string `json:"mime_type"`
 			FileSize int    `json:"file_size"`
 		} `json:"video"`
@@ -1909,6 +1928,8 @@ type MessageExt struct {
 	Src             string
 	Folder          string
 	UUID            string
+	Reply           MediaFile
+	Upload          MediaFile
 }
 
 type ItemDeleteMessage struct {
@@ -1922,10 +1943,24 @@ type TypeSrc struct {
 	Audio    bool
 }
 
+// MediaFile - file of incoming message or of message which user replied to
+type MediaFile struct {
+	MessageID int64
+	Kind      string // audio, voice, video, video_note, document, photo
+	FileID    string
+	FileName  string
+	MimeType  string
+	Performer string
+	Title     string
+	FileSize  int64
+}
+
 type DocumentMessage struct {
-	Src   string
-	Title string
-	Check bool
+	Src     string
+	Title   string
+	Check   bool
+	User    *botUser // sent audio is remembered for retagging
+	VideoID string
 }
 
 type Updates struct {
@@ -2141,7 +2176,7 @@ func (o *Message) sendDocument(T *Tasker, src DocumentMessage) {
 		return
 	}
 	if src.Src == "" {
-		o.Text = infoLabel + src.Title
+		o.Text = infoLabel + html.EscapeString(src.Title)
 		T.Add(nil, o.SendMessageWrapperTask, o)
 		o.AddCtx(T, paramGood+src.Src, true)
 		return
@@ -2158,8 +2193,8 @@ func (o *Message) sendDocument(T *Tasker, src DocumentMessage) {
 			typeFile = "photo"
 		case check("avi", "mp4"):
 			typeFile = "video" // or "animation"
-		case check("mp3", "ogg", "wav"):
-			typeFile = "audio"
+		case check(mp3, m4a):
+			typeFile = "audio" // other audio formats are not played by telegram as audio
 		}
 		file, err := os.Open(src.Src)
 		if err != nil {
@@ -2196,31 +2231,36 @@ func (o *Message) sendDocument(T *Tasker, src DocumentMessage) {
 			}
 		case check("avi", "mp4"):
 			fileId = ret.Result.Video.FileID
-		case check("mp3", "ogg", "wav"):
+		case check(mp3, m4a):
 			fileId = ret.Result.Audio.FileID
 		default:
 			fileId = ret.Result.Document.FileID
 		}
 		o.FileID = fileId
+		if src.User != nil && fileId != "" && isAudioExt(filepath.Ext(src.Src)) {
+			src.User.rememberSent(ret.Result.MessageID, newSentAudio(src, fileId))
+		}
 		o.AddCtx(T, paramGood+src.Src, true)
 		switch {
 		case check("json"):
 			if !debug {
 				os.Remove(src.Src) //delete photo if not send
 			}
-		case check(mp4):
-			jpgDel := strings.TrimSuffix(src.Src, mp4) + jpg
+		case check(mp4, webm, mkv):
+			jpgDel := strings.TrimSuffix(src.Src, filepath.Ext(src.Src)) + jpg
 			if !debug {
 				os.Remove(src.Src) //if not send not delete
 				os.Remove(jpgDel)
+				os.Remove(filepath.Dir(src.Src)) // only if empty
 			}
-		case check(mp3):
-			mp4Del := strings.TrimSuffix(src.Src, mp3) + mp4
-			jpgDel := strings.TrimSuffix(src.Src, mp3) + jpg
+		case isAudioExt(filepath.Ext(src.Src)):
+			mp4Del := strings.TrimSuffix(src.Src, filepath.Ext(src.Src)) + mp4
+			jpgDel := strings.TrimSuffix(src.Src, filepath.Ext(src.Src)) + jpg
 			if !debug {
 				os.Remove(src.Src) //if send mp4 may be delete
 				os.Remove(mp4Del)
 				os.Remove(jpgDel)
+				os.Remove(filepath.Dir(src.Src)) // only if empty
 			}
 		}
 	}()
@@ -2487,20 +2527,39 @@ func sendFiles(T *Tasker, task Thing, format string, message *Message) bool {
 		return false
 	default:
 	}
+	if len(v.Parts) > 0 && isAudioExt(format) {
+		sendChapters(T, v, format, message)
+		return true
+	}
 	var splitFiles []string
 	user := GetCtx[*botUser](T, userParam, message)
 	splitMp4 := true
-	if format == mp4 {
+	check := format
+	if isAudioExt(format) {
+		check = mp3 // all audio formats are switched by mp3 parameter
+	}
+	if isVideoExt(format) {
 		splitMp4 = !sBool(user.getParameter(paramParam, mp3))
 	}
 	if fileSize(v.URLSaved+format) >= limitFileTelegram && format != jpg && splitMp4 {
-		SplitMp(T, task, 0, limitFileTelegram, format, message)
-		splitFiles = searchFiles(v.URLSaved+"__", v.UUID, format)
+		if err := SplitMp(T, task, 0, limitFileTelegram, format, message); err != nil {
+			v.toLog(err.Error(), true)
+			m := *message
+			m.ReplyMarkup = Buttons{}
+			m.DelAfter = false
+			m.Text = infoLabel + m.tr("File is too big and was not split") + ": " + html.EscapeString(v.Artist+" ["+v.Song+"]") + " (" + html.EscapeString(err.Error()) + ")"
+			m.extensionMessaging(T, sendParam, false, m.sendMessage)
+			return false
+		}
+		splitFiles = searchFiles(v.URLSaved+"__", filepath.Dir(v.URLSaved), format)
+		sort.Strings(splitFiles)
 		for k, val := range splitFiles {
 			param := DocumentMessage{}
 			param.Src = val
-			param.Check = sBool(user.getParameter(paramParam, format))
-			param.Title = strconv.Itoa(k+1) + ") " + v.Artist + " [" + v.Song + "]"
+			param.Check = sBool(user.getParameter(paramParam, check))
+			param.Title = partTitle(v.Artist+" ["+v.Song+"]", k+1, len(splitFiles))
+			param.User = user
+			param.VideoID = v.ID
 			message.sendDocument(T, param)
 			<-time.After(1 * time.Second)
 		}
@@ -2508,13 +2567,122 @@ func sendFiles(T *Tasker, task Thing, format string, message *Message) bool {
 	} else {
 		param := DocumentMessage{}
 		param.Src = v.URLSaved + format
-		if format == mp4 {
+		if isVideoExt(format) {
 			param.Check = !sBool(user.getParameter(paramParam, mp3))
 		} else {
-			param.Check = sBool(user.getParameter(paramParam, format))
+			param.Check = sBool(user.getParameter(paramParam, check))
 		}
 		param.Title = v.Artist + " [" + v.Song + "]"
-		T.Add(param, message.SendDocumentWrapperTask, message)
+		param.User = user
+		param.VideoID = v.ID
+		if v.Ordered {
+			// keep order of playlist sending
+			message.sendDocument(T, param)
+		} else {
+			T.Add(param, message.SendDocumentWrapperTask, message)
+		}
+		return false
+	}
+}
+
+// InputMedia - element of media group
+type InputMedia struct {
+	Type    string `json:"type"`
+	Media   string `json:"media"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// SendMediaGroupReturn - answer of sendMediaGroup
+type SendMediaGroupReturn struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      []struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+}
+
+// sendMediaGroup([]DocumentMessage, string) bool
+// send 2-10 files of one type as album
+func (o *Message) sendMediaGroup(files []DocumentMessage, typeFile string) bool {
+	go o.sendTyping("upload_document")
+	data := &bytes.Buffer{}
+	writer := multipart.NewWriter(data)
+	writer.WriteField("chat_id", sprintf("%d", o.ChatID))
+	writer.WriteField("disable_notification", strconv.FormatBool(o.DisableNotification))
+	var media []InputMedia
+	for k, v := range files {
+		name := sprintf("file%d", k)
+		media = append(media, InputMedia{Type: typeFile, Media: "attach://" + name, Caption: v.Title})
+		file, err := os.Open(v.Src)
+		if err != nil {
+			toLog(err)
+			return false
+		}
+		part, err := writer.CreateFormFile(name, filepath.Base(v.Src))
+		if err != nil {
+			toLog(err)
+		}
+		_, err = io.Copy(part, file)
+		if err != nil {
+			toLog(err)
+		}
+		file.Close()
+	}
+	mediaJson, err := json.Marshal(media)
+	if err != nil {
+		toLog(err)
 		return false
 	}
+	writer.WriteField("media", string(mediaJson))
+	writer.Close()
+	ret := new(SendMediaGroupReturn)
+	telegramQuery("/sendMediaGroup", data, ret, true, writer.Boundary())
+	if !ret.Ok {
+		toLog("sendMediaGroup", ret.Description)
+	}
+	return ret.Ok
+}
+
+// GetFileReturn - answer of getFile
+type GetFileReturn struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      struct {
+		FileID   string `json:"file_id"`
+		FileSize int64  `json:"file_size"`
+		FilePath string `json:"file_path"`
+	} `json:"result"`
+}
+
+// getTelegramFile(string, string) error
+// download file of chat by file_id (Bot API limit is 20 MB)
+func getTelegramFile(fileID, path string) error {
+	ret := new(GetFileReturn)
+	if err := telegramQuery("/getFile", map[string]string{"file_id": fileID}, ret, false, ""); err != nil {
+		return err
+	}
+	if !ret.Ok {
+		return errors.New("getFile: " + ret.Description)
+	}
+	if ret.Result.FileSize > limitGetFile {
+		return errors.New(sprintf("file is bigger than %d MB", limitGetFile/1000000))
+	}
+	resp, err := http.Get(telegramFileUrl + api + "/" + ret.Result.FilePath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(sprintf("%d - error downloading file", resp.StatusCode))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.LimitReader(resp.Body, limitGetFile)); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
 }
@@ -82,7 +82,7 @@ func downloading_tasker_tester(T *Tasker, task Thing, message *Message) {
 			"playlistItems" + startDelimeter +
 			"key=" + testgapi + delimeter +
 			"playlistId=" + "%s" + delimeter +
-			"part=contentDetails" + delimeter +
+			"part=snippet,contentDetails" + delimeter +
 			"maxResults=" + maxResults + delimeter +
 			"pageToken="
 	videoQ :=
@@ -91,6 +91,12 @@ func downloading_tasker_tester(T *Tasker, task Thing, message *Message) {
 			"key=" + testgapi + delimeter +
 			"id=" + "%s" + delimeter +
 			"part=snippet,contentDetails"
+	playlistInfoQ :=
+		resource +
+			"playlists" + startDelimeter +
+			"key=" + testgapi + delimeter +
+			"id=" + "%s" + delimeter +
+			"part=snippet"
 	obj := new(Action)
 	obj.Db = new(DataBase)
 	path, err := filepath.Abs(filepath.Dir(os.Args[0]))
@@ -114,6 +120,7 @@ func downloading_tasker_tester(T *Tasker, task Thing, message *Message) {
 	tmp.M = new(sync.RWMutex)
 	tmp.playlistQ = playlistQ
 	tmp.videoQ = videoQ
+	tmp.playlistInfoQ = playlistInfoQ
 	tmp.GetInformationVideo(T, testid, message)
 	fmt.Println(">>>", t.Name(), " - done", v1)
 }
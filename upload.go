@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	commandUpload = "!!!upload!!!"
+	// paramUploadCover - file_id of photo for next uploaded file and time of sending
+	paramUploadCover = "upload_cover"
+	uploadCoverTTL   = 30 * time.Minute
+	uploadFolder     = "upload"
+)
+
+var uploadHelp = `Send or forward audio, voice or video (up to 20 MB) - it is converted to chosen audio format.
+Caption <code>Artist - Title</code> sets tags, otherwise tags of file or its name are used.
+Photo sent before the file becomes its cover.`
+
+// uploadMimeExt - extension of uploaded file without name by mime type
+var uploadMimeExt = map[string]string{
+	"audio/mpeg":       mp3,
+	"audio/mp3":        mp3,
+	"audio/ogg":        ogg,
+	"audio/opus":       ogg,
+	"audio/flac":       flac,
+	"audio/x-flac":     flac,
+	"audio/mp4":        m4a,
+	"audio/x-m4a":      m4a,
+	"audio/aac":        ".aac",
+	"audio/wav":        ".wav",
+	"audio/x-wav":      ".wav",
+	"video/mp4":        mp4,
+	"video/webm":       webm,
+	"video/x-matroska": mkv,
+	"video/quicktime":  ".mov",
+}
+
+// uploadMedia(*Result) MediaFile
+// media file of incoming message, biggest size of photo
+func uploadMedia(val *Result) MediaFile {
+	m := val.Message
+	ret := MediaFile{MessageID: m.MessageID}
+	switch {
+	case m.Audio.FileID != "":
+		ret.Kind, ret.FileID, ret.FileName, ret.MimeType, ret.FileSize = "audio", m.Audio.FileID, m.Audio.FileName, m.Audio.MimeType, int64(m.Audio.FileSize)
+		ret.Performer, ret.Title = m.Audio.Performer, m.Audio.Title
+	case m.Voice.FileID != "":
+		ret.Kind, ret.FileID, ret.MimeType, ret.FileSize = "voice", m.Voice.FileID, m.Voice.MimeType, int64(m.Voice.FileSize)
+	case m.Video.FileID != "":
+		ret.Kind, ret.FileID, ret.FileName, ret.MimeType, ret.FileSize = "video", m.Video.FileID, m.Video.FileName, m.Video.MimeType, int64(m.Video.FileSize)
+	case m.VideoNote.FileID != "":
+		ret.Kind, ret.FileID, ret.MimeType, ret.FileSize = "video_note", m.VideoNote.FileID, "video/mp4", int64(m.VideoNote.FileSize)
+	case m.Document.FileID != "":
+		ret.Kind, ret.FileID, ret.FileName, ret.MimeType, ret.FileSize = "document", m.Document.FileID, m.Document.FileName, m.Document.MimeType, int64(m.Document.FileSize)
+	case len(m.Photo) > 0:
+		p := m.Photo[len(m.Photo)-1]
+		ret.Kind, ret.FileID, ret.FileSize = "photo", p.FileID, int64(p.FileSize)
+	}
+	return ret
+}
+
+// convertible() bool
+// file has audio which ffmpeg can extract
+func (o MediaFile) convertible() bool {
+	switch o.Kind {
+	case "audio", "voice", "video", "video_note":
+		return true
+	case "document":
+		return strings.HasPrefix(o.MimeType, "audio/") || strings.HasPrefix(o.MimeType, "video/")
+	}
+	return false
+}
+
+// ext() string
+// extension of file by name or mime type
+func (o MediaFile) ext() string {
+	if ext := strings.ToLower(filepath.Ext(o.FileName)); ext != "" {
+		return ext
+	}
+	if ext, ok := uploadMimeExt[strings.ToLower(o.MimeType)]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+// uploadTrack(MediaFile, map[string]string, string) (*JsonPls, error)
+// track of uploaded file. Artist and title: caption, tags of file, audio info of Telegram, file name
+func uploadTrack(media MediaFile, tags map[string]string, caption string) (*JsonPls, error) {
+	v := new(JsonPls)
+	name := strings.TrimSuffix(filepath.Base(media.FileName), filepath.Ext(media.FileName))
+	switch {
+	case tags["title"] != "":
+		v.Artist, v.Song = tags["artist"], tags["title"]
+	case media.Title != "":
+		v.Artist, v.Song = media.Performer, media.Title
+	case name != "" && name != ".":
+		v.Song = strings.ReplaceAll(name, "_", " ")
+		if artist, song, err := parseTagArg(v.Song, SentAudio{}); err == nil {
+			v.Artist, v.Song = artist, song
+		}
+	default:
+		v.Song = strings.ReplaceAll(media.Kind, "_", " ") + " " + time.Now().Format("2006-01-02 15:04")
+	}
+	if caption = strings.TrimSpace(caption); caption != "" {
+		artist, song, err := parseTagArg(caption, SentAudio{Artist: v.Artist, Song: v.Song})
+		if err != nil {
+			return nil, err
+		}
+		v.Artist, v.Song = artist, song
+	}
+	v.Album, v.AlbumArtist, v.Genre = tags["album"], tags["album_artist"], tags["genre"]
+	if date := tags["date"]; len(date) >= 4 {
+		v.Year = date[:4]
+	}
+	v.Track, v.TrackTotal = splitTrack(tags["track"])
+	if v.Track == 0 {
+		v.TrackTotal = 0
+	}
+	return v, nil
+}
+
+// setUploadCover(string)
+// remember photo as cover of next uploaded file, empty - forget
+func (o *botUser) setUploadCover(fileID string) {
+	if fileID == "" {
+		o.setParameter(paramParam, paramUploadCover, "")
+		return
+	}
+	o.setParameter(paramParam, paramUploadCover, fileID+" "+strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// uploadCover() string
+// file_id of photo for uploaded file, empty if it was sent more than uploadCoverTTL ago
+func (o *botUser) uploadCover() string {
+	id, sent, _ := strings.Cut(o.getParameter(paramParam, paramUploadCover), " ")
+	unix, err := strconv.ParseInt(sent, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)) > uploadCoverTTL {
+		return ""
+	}
+	return id
+}
+
+// saveUploadCover(string, string, []byte, string, CoverSettings) error
+// cover from photo file, else from picture of uploaded file, else placeholder with title
+func saveUploadCover(path, photo string, embedded []byte, title string, settings CoverSettings) error {
+	var img image.Image
+	if data, err := os.ReadFile(photo); err == nil {
+		img, _, _ = image.Decode(bytes.NewReader(data))
+	}
+	if img == nil && len(embedded) > 0 {
+		img, _, _ = image.Decode(bytes.NewReader(embedded))
+	}
+	var cover *image.RGBA
+	if img != nil {
+		cover = processCover(img, settings)
+	} else {
+		size := settings.Size
+		if size == 0 {
+			size = placeholderSize
+		}
+		cover = placeholderCover(title, size)
+	}
+	return saveJpeg(path, cover, settings.Quality)
+}
+
+// convertUpload(*Tasker, MediaFile, string, *botUser, *Message) (*JsonPls, AudioFormat, error)
+// download uploaded file and convert it by pipeline of YouTube audio: format, tags, cover and loudness of user
+func convertUpload(T *Tasker, media MediaFile, caption string, usr *botUser, message *Message) (*JsonPls, AudioFormat, error) {
+	format := usr.audioFormat()
+	folder := filepath.Join(message.UUID, uploadFolder)
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		return nil, format, err
+	}
+	src := filepath.Join(folder, uploadFolder+media.ext())
+	if err := getTelegramFile(media.FileID, src); err != nil {
+		return nil, format, err
+	}
+	tags, embedded, _ := readFileTags(src) // other formats have no tags for us
+	v, err := uploadTrack(media, tags, caption)
+	if err != nil {
+		return nil, format, err
+	}
+	v.UUID = message.UUID
+	v.URLSaved = filepath.Join(folder, fileName(v, usr.nameTemplate()))
+	// source is named as downloaded video, ffmpeg detects format by content
+	if err := os.Rename(src, v.URLSaved+mp4); err != nil {
+		return nil, format, err
+	}
+	photo := ""
+	if id := usr.uploadCover(); id != "" {
+		photo = filepath.Join(folder, "photo"+jpg)
+		if err := getTelegramFile(id, photo); err != nil {
+			v.toLog("cover: "+err.Error(), true)
+		}
+		defer os.Remove(photo)
+		usr.setUploadCover("")
+	}
+	if err := saveUploadCover(v.URLSaved+jpg, photo, embedded, v.Artist+" - "+v.Song, usr.coverSettings()); err != nil {
+		return nil, format, err
+	}
+	message.AddCtx(T, userParam, usr)
+	message.AddCtx(T, v.URLSaved+jpg, true)
+	message.AddCtx(T, v.URLSaved+mp4, true)
+	mode := usr.loudnessMode()
+	measureSource(v, mode)
+	ConvertAudio(T, Thing{Input: v}, 0, format, message)
+	if existFile(v.URLSaved+format.Ext) == "" {
+		return nil, format, errors.New("ffmpeg could not convert file")
+	}
+	if mode == loudnessGain {
+		if _, err := applyReplayGain(v, format, nil); err != nil {
+			v.toLog("loudness: "+err.Error(), true)
+		}
+	}
+	return v, format, nil
+}
+
+// addUploadCommands(*Commands, *Tasker)
+// files and photos sent to bot: conversion of audio and video, cover for next file
+func (obj *Action) addUploadCommands(cmds *Commands, MainTasker *Tasker) {
+	cmds.Add(commandUpload, "📥upload", false, false, func(message Message, usr *botUser) {
+		media := message.Upload
+		send := func(text string) {
+			message.Text = text
+			MainTasker.Add(nil, message.SendMessageWrapperTask, &message)
+		}
+		switch {
+		case media.Kind == "photo":
+			usr.setUploadCover(media.FileID)
+			send(message.tr("Cover is saved for next uploaded file") + sprintf(" (%d min)", int(uploadCoverTTL.Minutes())))
+			return
+		case !media.convertible():
+			send(uploadHelp)
+			return
+		case media.FileSize > limitGetFile:
+			send(infoLabel + message.tr("File is too big, bot can download files up to 20 MB"))
+			return
+		}
+		hold := new(QuotaHold)
+		if reason := hold.reserve(usr, Quota{Tracks: 1, Bytes: media.FileSize}); reason != "" {
+			send(infoLabel + message.tr("Quota exceeded ("+reason+").") + " /quota")
+			return
+		}
+		if MainTasker.Add(UploadTask{User: usr, Hold: hold}, message.UploadWrapperTask, &message) == nil {
+			hold.refund(usr)
+		}
+	})
+}
+
+// UploadTask - user of uploaded file and quota reserved for it
+type UploadTask struct {
+	User *botUser
+	Hold *QuotaHold
+}
+
+// UploadWrapperTask(*Tasker, Thing, *Message)
+// convert uploaded file of message and send result with tasker, quota is refunded if file is not converted
+func (o Message) UploadWrapperTask(T *Tasker, task Thing, message *Message) {
+	input := task.Input.(UploadTask)
+	usr := input.User
+	defer input.Hold.refund(usr)
+	select {
+	case <-T.Branch.Context.Done():
+		return
+	default:
+	}
+	send := func(text string) {
+		o.Text = text
+		o.extensionMessaging(T, sendParam, false, o.sendMessage)
+	}
+	go o.sendTyping("record_voice")
+	v, format, err := convertUpload(T, o.Upload, commandArgument(o, commandUpload), usr, &o)
+	if err != nil {
+		os.RemoveAll(filepath.Join(o.UUID, uploadFolder))
+		send(infoLabel + o.tr("File was not converted") + ": " + html.EscapeString(err.Error()))
+		return
+	}
+	if fileSize(v.URLSaved+format.Ext) >= limitFileTelegram {
+		os.RemoveAll(filepath.Join(o.UUID, uploadFolder))
+		send(infoLabel + o.tr("File is too big after conversion, choose other format"))
+		return
+	}
+	input.Hold.keep()
+	param := DocumentMessage{}
+	param.Src = v.URLSaved + format.Ext
+	param.Check = true
+	param.Title = v.Artist + " [" + v.Song + "]"
+	param.User = usr
+	o.sendDocument(T, param)
+}
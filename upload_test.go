@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_uploadMedia(t *testing.T) {
+	for _, tt := range []struct {
+		update string
+		kind   string
+		ext    string
+		conv   bool
+	}{
+		{`{"message":{"audio":{"file_id":"a","file_name":"Song.FLAC","mime_type":"audio/flac","performer":"P","title":"T"}}}`, "audio", flac, true},
+		{`{"message":{"voice":{"file_id":"v","mime_type":"audio/ogg"}}}`, "voice", ogg, true},
+		{`{"message":{"video_note":{"file_id":"n"}}}`, "video_note", mp4, true},
+		{`{"message":{"document":{"file_id":"d","file_name":"clip","mime_type":"video/webm"}}}`, "document", webm, true},
+		{`{"message":{"document":{"file_id":"d","file_name":"book.pdf","mime_type":"application/pdf"}}}`, "document", ".pdf", false},
+		{`{"message":{"photo":[{"file_id":"small"},{"file_id":"big"}]}}`, "photo", ".bin", false},
+	} {
+		var r Result
+		if err := json.Unmarshal([]byte(tt.update), &r); err != nil {
+			t.Fatal(err)
+		}
+		m := uploadMedia(&r)
+		if m.Kind != tt.kind || m.ext() != tt.ext || m.convertible() != tt.conv {
+			t.Errorf("uploadMedia(%s) = %+v, ext %s", tt.update, m, m.ext())
+		}
+	}
+	var r Result
+	json.Unmarshal([]byte(`{"message":{"photo":[{"file_id":"small"},{"file_id":"big"}]}}`), &r)
+	if m := uploadMedia(&r); m.FileID != "big" {
+		t.Errorf("photo = %s, want biggest", m.FileID)
+	}
+}
+
+func Test_uploadTrack(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		media        MediaFile
+		tags         map[string]string
+		caption      string
+		artist, song string
+	}{
+		{"tags", MediaFile{FileName: "x.mp3", Title: "Tg"}, map[string]string{"artist": "A", "title": "T"}, "", "A", "T"},
+		{"telegram", MediaFile{FileName: "x.mp3", Performer: "P", Title: "Tg"}, nil, "", "P", "Tg"},
+		{"file name", MediaFile{FileName: "My_Band - My_Song.wav"}, nil, "", "My Band", "My Song"},
+		{"caption", MediaFile{FileName: "rec.ogg"}, nil, "Artist - Title", "Artist", "Title"},
+		{"caption title", MediaFile{Performer: "P", Title: "Old"}, nil, "New", "P", "New"},
+	} {
+		v, err := uploadTrack(tt.media, tt.tags, tt.caption)
+		if err != nil || v.Artist != tt.artist || v.Song != tt.song {
+			t.Errorf("uploadTrack(%s) = %+v, %v", tt.name, v, err)
+		}
+	}
+	v, _ := uploadTrack(MediaFile{Kind: "video_note"}, map[string]string{"title": "T", "date": "2021-05-01", "track": "0/9", "album": "Al"}, "")
+	if v.Year != "2021" || v.Track != 0 || v.TrackTotal != 0 || v.Album != "Al" {
+		t.Errorf("uploadTrack() fields = %+v", v)
+	}
+	if v, _ := uploadTrack(MediaFile{Kind: "video_note"}, nil, ""); len(v.Song) < len("video note ") || v.Song[:11] != "video note " {
+		t.Errorf("uploadTrack() without name = %q", v.Song)
+	}
+	if _, err := uploadTrack(MediaFile{FileName: "a.mp3"}, nil, " - "); err == nil {
+		t.Error("empty caption tags are accepted")
+	}
+}
+
+func Test_uploadCover(t *testing.T) {
+	db := new(DataBase)
+	db.Open(filepath.Join(t.TempDir(), "upload"))
+	if db.Err != nil {
+		t.Fatal(db.Err)
+	}
+	defer db.Close()
+	usr := new(botUser).New(db, 1)
+	usr.setUploadCover("photo")
+	if got := usr.uploadCover(); got != "photo" {
+		t.Errorf("uploadCover() = %q", got)
+	}
+	usr.setParameter(paramParam, paramUploadCover, sprintf("photo %d", time.Now().Add(-uploadCoverTTL-time.Minute).Unix()))
+	if got := usr.uploadCover(); got != "" {
+		t.Errorf("old cover = %q", got)
+	}
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for k := range img.Pix {
+		img.Pix[k] = 0xff
+	}
+	img.SetRGBA(0, 0, color.RGBA{0, 0, 0, 0xff})
+	var embedded bytes.Buffer
+	jpeg.Encode(&embedded, img, nil)
+	settings := CoverSettings{Square: true, Quality: coverQuality}
+	for name, data := range map[string][]byte{"embedded": embedded.Bytes(), "placeholder": nil} {
+		path := filepath.Join(dir, name+jpg)
+		if err := saveUploadCover(path, filepath.Join(dir, "missing"+jpg), data, "Artist - Title", settings); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jpeg.DecodeConfig(f)
+		f.Close()
+		want := 32
+		if data == nil {
+			want = placeholderSize
+		}
+		if err != nil || cfg.Width != want || cfg.Height != want {
+			t.Errorf("%s cover = %dx%d, %v", name, cfg.Width, cfg.Height, err)
+		}
+	}
+}
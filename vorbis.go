@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	"strings"
+)
+
+const (
+	flacBlockStreamInfo = 0
+	flacBlockComment    = 4
+	flacBlockPicture    = 6
+	// oggMaxSegments - lacing values in one page
+	oggMaxSegments = 255
+)
+
+// vorbisKeys - vorbis comment names for keys of trackTags, other keys are written as is
+var vorbisKeys = map[string]string{
+	"title":        "TITLE",
+	"artist":       "ARTIST",
+	"album":        "ALBUM",
+	"album_artist": "ALBUMARTIST",
+	"date":         "DATE",
+	"genre":        "GENRE",
+	"publisher":    "ORGANIZATION",
+	"composer":     "COMPOSER",
+	"comment":      "COMMENT",
+}
+
+// pictureBlock([]byte) ([]byte, error)
+// FLAC PICTURE structure of front cover, used as FLAC block and METADATA_BLOCK_PICTURE
+func pictureBlock(cover []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(cover))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	write := func(v ...any) {
+		for _, val := range v {
+			binary.Write(&b, binary.BigEndian, val)
+		}
+	}
+	mime := coverMime(cover)
+	write(uint32(3), uint32(len(mime))) // front cover
+	b.WriteString(mime)
+	write(uint32(0), uint32(cfg.Width), uint32(cfg.Height), uint32(24), uint32(0), uint32(len(cover)))
+	b.Write(cover)
+	return b.Bytes(), nil
+}
+
+// parsePictureBlock([]byte) ([]byte, uint32, error)
+// picture data and picture type of FLAC PICTURE structure
+func parsePictureBlock(b []byte) ([]byte, uint32, error) {
+	bad := errors.New("wrong picture block")
+	if len(b) < 8 {
+		return nil, 0, bad
+	}
+	kind := binary.BigEndian.Uint32(b)
+	pos := 4
+	for k := 0; k < 2; k++ { // mime, description
+		if pos+4 > len(b) {
+			return nil, 0, bad
+		}
+		pos += 4 + int(binary.BigEndian.Uint32(b[pos:]))
+	}
+	pos += 16 // width, height, depth, colors
+	if pos+4 > len(b) {
+		return nil, 0, bad
+	}
+	n := int(binary.BigEndian.Uint32(b[pos:]))
+	pos += 4
+	if pos+n > len(b) {
+		return nil, 0, bad
+	}
+	return b[pos : pos+n], kind, nil
+}
+
+// marshalVorbisComment(string, map[string]string, []byte) ([]byte, error)
+// vorbis comment structure without framing bit, cover as METADATA_BLOCK_PICTURE
+func marshalVorbisComment(vendor string, tags map[string]string, cover []byte) ([]byte, error) {
+	var comments []string
+	for _, k := range sortedKeys(tags) {
+		switch name, ok := vorbisKeys[k]; {
+		case ok:
+			comments = append(comments, name+"="+tags[k])
+		case k == "track":
+			track, total := splitTrack(tags[k])
+			comments = append(comments, sprintf("TRACKNUMBER=%d", track))
+			if total > 0 {
+				comments = append(comments, sprintf("TRACKTOTAL=%d", total))
+			}
+		default:
+			comments = append(comments, strings.ToUpper(k)+"="+tags[k])
+		}
+	}
+	if len(cover) > 0 {
+		picture, err := pictureBlock(cover)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(picture))
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes(), nil
+}
+
+// parseVorbisComment([]byte) (string, map[string]string, []byte, error)
+// vendor, tags in keys of trackTags and front cover of vorbis comment structure
+func parseVorbisComment(b []byte) (string, map[string]string, []byte, error) {
+	bad := errors.New("wrong vorbis comment")
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	vendor, ok := next()
+	if !ok || len(b) < 4 {
+		return "", nil, nil, bad
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	names := make(map[string]string)
+	for k, name := range vorbisKeys {
+		names[name] = k
+	}
+	names["DESCRIPTION"] = "comment"
+	names["LABEL"] = "publisher"
+	tags := make(map[string]string)
+	var cover []byte
+	var track, total int
+	for k := 0; k < count; k++ {
+		c, ok := next()
+		if !ok {
+			return "", nil, nil, bad
+		}
+		name, val, _ := strings.Cut(c, "=")
+		name = strings.ToUpper(name)
+		switch {
+		case name == "METADATA_BLOCK_PICTURE":
+			data, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				continue
+			}
+			if picture, kind, err := parsePictureBlock(data); err == nil && (cover == nil || kind == 3) {
+				cover = picture
+			}
+		case name == "TRACKNUMBER":
+			track, total = splitTrack(val)
+		case name == "TRACKTOTAL" || name == "TOTALTRACKS":
+			total, _ = splitTrack(val)
+		case names[name] != "":
+			tags[names[name]] = val
+		default:
+			tags[name] = val
+		}
+	}
+	if track > 0 {
+		tags["track"] = joinTrack(track, total)
+	}
+	return vendor, tags, cover, nil
+}
+
+// flacBlocks([]byte) ([][]byte, int, error)
+// metadata blocks (with 4 bytes header) of FLAC file and start of audio frames
+func flacBlocks(data []byte) ([][]byte, int, error) {
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return nil, 0, errors.New("not a FLAC file")
+	}
+	var blocks [][]byte
+	pos := 4
+	for {
+		if pos+4 > len(data) {
+			return nil, 0, errors.New("wrong FLAC metadata")
+		}
+		n := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		if pos+4+n > len(data) {
+			return nil, 0, errors.New("wrong FLAC metadata")
+		}
+		blocks = append(blocks, data[pos:pos+4+n])
+		last := data[pos]&0x80 != 0
+		pos += 4 + n
+		if last {
+			return blocks, pos, nil
+		}
+	}
+}
+
+// readFlacTags([]byte) (map[string]string, []byte, error)
+// tags and front cover of FLAC
+func readFlacTags(data []byte) (map[string]string, []byte, error) {
+	blocks, _, err := flacBlocks(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags := make(map[string]string)
+	var cover []byte
+	for _, block := range blocks {
+		switch block[0] & 0x7f {
+		case flacBlockComment:
+			_, comments, picture, err := parseVorbisComment(block[4:])
+			if err != nil {
+				return nil, nil, err
+			}
+			tags = comments
+			if cover == nil {
+				cover = picture
+			}
+		case flacBlockPicture:
+			if picture, kind, err := parsePictureBlock(block[4:]); err == nil && (cover == nil || kind == 3) {
+				cover = picture
+			}
+		}
+	}
+	return tags, cover, nil
+}
+
+// flacBlock(byte, []byte) ([]byte, error)
+// metadata block with header, last flag is set later
+func flacBlock(kind byte, body []byte) ([]byte, error) {
+	if len(body) >= 1<<24 {
+		return nil, errors.New("FLAC metadata block is too big")
+	}
+	return append([]byte{kind, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...), nil
+}
+
+// writeFlacTags([]byte, map[string]string, []byte) ([]byte, error)
+// FLAC with new VORBIS_COMMENT and PICTURE blocks, padding is dropped
+func writeFlacTags(data []byte, tags map[string]string, cover []byte) ([]byte, error) {
+	blocks, audio, err := flacBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+	vendor := tagVendor
+	var keep [][]byte
+	for _, block := range blocks {
+		switch block[0] & 0x7f {
+		case flacBlockComment:
+			if v, _, _, err := parseVorbisComment(block[4:]); err == nil {
+				vendor = v
+			}
+		case flacBlockPicture, 1: // 1 - padding
+		default:
+			keep = append(keep, block)
+		}
+	}
+	if len(keep) == 0 || keep[0][0]&0x7f != flacBlockStreamInfo {
+		return nil, errors.New("FLAC without STREAMINFO")
+	}
+	body, err := marshalVorbisComment(vendor, tags, nil)
+	if err != nil {
+		return nil, err
+	}
+	block, err := flacBlock(flacBlockComment, body)
+	if err != nil {
+		return nil, err
+	}
+	keep = append(keep, block)
+	if len(cover) > 0 {
+		picture, err := pictureBlock(cover)
+		if err != nil {
+			return nil, err
+		}
+		if block, err = flacBlock(flacBlockPicture, picture); err != nil {
+			return nil, err
+		}
+		keep = append(keep, block)
+	}
+	ret := []byte("fLaC")
+	for k, block := range keep {
+		header := block[0] & 0x7f
+		if k == len(keep)-1 {
+			header |= 0x80
+		}
+		ret = append(ret, header)
+		ret = append(ret, block[1:]...)
+	}
+	return append(ret, data[audio:]...), nil
+}
+
+// oggPage - page of Ogg stream
+type oggPage struct {
+	Type     byte // 1 - continued packet, 2 - first page, 4 - last page
+	Granule  uint64
+	Serial   uint32
+	Sequence uint32
+	Lacing   []byte
+	Body     []byte
+}
+
+// oggCRCTable - CRC-32 of Ogg: polynomial 0x04c11db7, not reflected
+var oggCRCTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for k := 0; k < 8; k++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+// oggCRC([]byte) uint32
+// checksum of page with zero checksum field
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
+
+// bytes() []byte
+// page with checksum
+func (p oggPage) bytes() []byte {
+	b := make([]byte, 27, 27+len(p.Lacing)+len(p.Body))
+	copy(b, "OggS")
+	b[5] = p.Type
+	binary.LittleEndian.PutUint64(b[6:], p.Granule)
+	binary.LittleEndian.PutUint32(b[14:], p.Serial)
+	binary.LittleEndian.PutUint32(b[18:], p.Sequence)
+	b[26] = byte(len(p.Lacing))
+	b = append(b, p.Lacing...)
+	b = append(b, p.Body...)
+	binary.LittleEndian.PutUint32(b[22:], oggCRC(b))
+	return b
+}
+
+// parseOggPages([]byte) ([]oggPage, error)
+// all pages with check of checksums
+func parseOggPages(data []byte) ([]oggPage, error) {
+	var pages []oggPage
+	for pos := 0; pos < len(data); {
+		if pos+27 > len(data) || string(data[pos:pos+4]) != "OggS" || data[pos+4] != 0 {
+			return nil, errors.New("wrong Ogg page")
+		}
+		n := int(data[pos+26])
+		if pos+27+n > len(data) {
+			return nil, errors.New("wrong Ogg page")
+		}
+		p := oggPage{Type: data[pos+5], Granule: binary.LittleEndian.Uint64(data[pos+6:]), Serial: binary.LittleEndian.Uint32(data[pos+14:]), Sequence: binary.LittleEndian.Uint32(data[pos+18:])}
+		p.Lacing = data[pos+27 : pos+27+n]
+		size := 0
+		for _, l := range p.Lacing {
+			size += int(l)
+		}
+		if pos+27+n+size > len(data) {
+			return nil, errors.New("wrong Ogg page")
+		}
+		p.Body = data[pos+27+n : pos+27+n+size]
+		// page is built again with checksum of its content
+		if !bytes.Equal(p.bytes(), data[pos:pos+27+n+size]) {
+			return nil, errors.New(sprintf("wrong checksum of Ogg page %d", p.Sequence))
+		}
+		pages = append(pages, p)
+		pos += 27 + n + size
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("empty Ogg file")
+	}
+	return pages, nil
+}
+
+// oggHeaders([]oggPage) ([][]byte, int, error)
+// first two packets (Opus head and tags) and count of their pages, tags must end page
+func oggHeaders(pages []oggPage) ([][]byte, int, error) {
+	var packets [][]byte
+	var packet []byte
+	for k, p := range pages {
+		if p.Serial != pages[0].Serial {
+			return nil, 0, errors.New("multiplexed Ogg is not supported")
+		}
+		pos := 0
+		for i, l := range p.Lacing {
+			packet = append(packet, p.Body[pos:pos+int(l)]...)
+			pos += int(l)
+			if l == 255 {
+				continue
+			}
+			packets = append(packets, packet)
+			packet = nil
+			if len(packets) == 2 {
+				if i != len(p.Lacing)-1 {
+					return nil, 0, errors.New("audio starts on page of Ogg tags")
+				}
+				if !bytes.HasPrefix(packets[0], []byte("OpusHead")) || !bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+					return nil, 0, errors.New("only Ogg Opus is supported")
+				}
+				return packets, k + 1, nil
+			}
+		}
+	}
+	return nil, 0, errors.New("Ogg without tags")
+}
+
+// readOggTags([]byte) (map[string]string, []byte, error)
+// tags and front cover of Ogg Opus
+func readOggTags(data []byte) (map[string]string, []byte, error) {
+	pages, err := parseOggPages(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	packets, _, err := oggHeaders(pages)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, tags, cover, err := parseVorbisComment(packets[1][len("OpusTags"):])
+	return tags, cover, err
+}
+
+// oggPacketPages([]byte, uint32, uint32) []oggPage
+// pages of one packet from sequence number, packet ends last page
+func oggPacketPages(packet []byte, serial, sequence uint32) []oggPage {
+	var lacing []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+	var pages []oggPage
+	pos := 0
+	for k := 0; k < len(lacing); k += oggMaxSegments {
+		p := oggPage{Serial: serial, Sequence: sequence + uint32(len(pages)), Granule: ^uint64(0)}
+		if k > 0 {
+			p.Type = 1
+		}
+		p.Lacing = lacing[k:min(k+oggMaxSegments, len(lacing))]
+		size := 0
+		for _, l := range p.Lacing {
+			size += int(l)
+		}
+		p.Body = packet[pos : pos+size]
+		pos += size
+		pages = append(pages, p)
+	}
+	pages[len(pages)-1].Granule = 0 // headers have granule 0
+	return pages
+}
+
+// writeOggTags([]byte, map[string]string, []byte) ([]byte, error)
+// Ogg Opus with new OpusTags packet, next pages are renumbered
+func writeOggTags(data []byte, tags map[string]string, cover []byte) ([]byte, error) {
+	pages, err := parseOggPages(data)
+	if err != nil {
+		return nil, err
+	}
+	packets, headerPages, err := oggHeaders(pages)
+	if err != nil {
+		return nil, err
+	}
+	vendor, _, _, err := parseVorbisComment(packets[1][len("OpusTags"):])
+	if err != nil {
+		vendor = tagVendor
+	}
+	comment, err := marshalVorbisComment(vendor, tags, cover)
+	if err != nil {
+		return nil, err
+	}
+	serial := pages[0].Serial
+	var ret []byte
+	head := oggPacketPages(packets[0], serial, 0)
+	head[0].Type = 2
+	for _, p := range head {
+		ret = append(ret, p.bytes()...)
+	}
+	tagPages := oggPacketPages(append([]byte("OpusTags"), comment...), serial, uint32(len(head)))
+	for _, p := range tagPages {
+		ret = append(ret, p.bytes()...)
+	}
+	sequence := uint32(len(head) + len(tagPages))
+	for _, p := range pages[headerPages:] {
+		p.Sequence = sequence
+		sequence++
+		ret = append(ret, p.bytes()...)
+	}
+	return ret, nil
+}
@@ -15,40 +15,14 @@ type PlaylistItem struct {
 		Etag    string `json:"etag"`
 		ID      string `json:"id"`
 		Snippet struct {
-			PublishedAt time.Time `json:"publishedAt"`
-			ChannelID   string    `json:"channelId"`
-			Title       string    `json:"title"`
-			Description string    `json:"description"`
-			Thumbnails  struct {
-				Default struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"default"`
-				Medium struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"medium"`
-				High struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"high"`
-				Standard struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"standard"`
-				Maxres struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"maxres"`
-			} `json:"thumbnails"`
-			ChannelTitle string `json:"channelTitle"`
-			PlaylistID   string `json:"playlistId"`
-			Position     int    `json:"position"`
+			PublishedAt  time.Time  `json:"publishedAt"`
+			ChannelID    string     `json:"channelId"`
+			Title        string     `json:"title"`
+			Description  string     `json:"description"`
+			Thumbnails   Thumbnails `json:"thumbnails"`
+			ChannelTitle string     `json:"channelTitle"`
+			PlaylistID   string     `json:"playlistId"`
+			Position     int        `json:"position"`
 			ResourceID   struct {
 				Kind    string `json:"kind"`
 				VideoID string `json:"videoId"`
@@ -76,41 +50,15 @@ type ItemInformation struct {
 		Etag    string `json:"etag"`
 		ID      string `json:"id"`
 		Snippet struct {
-			PublishedAt time.Time `json:"publishedAt"`
-			ChannelID   string    `json:"channelId"`
-			Title       string    `json:"title"`
-			Description string    `json:"description"`
-			Thumbnails  struct {
-				Default struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"default"`
-				Medium struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"medium"`
-				High struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"high"`
-				Standard struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"standard"`
-				Maxres struct {
-					URL    string `json:"url"`
-					Width  int    `json:"width"`
-					Height int    `json:"height"`
-				} `json:"maxres"`
-			} `json:"thumbnails"`
-			ChannelTitle         string   `json:"channelTitle"`
-			Tags                 []string `json:"tags"`
-			CategoryID           string   `json:"categoryId"`
-			LiveBroadcastContent string   `json:"liveBroadcastContent"`
+			PublishedAt          time.Time  `json:"publishedAt"`
+			ChannelID            string     `json:"channelId"`
+			Title                string     `json:"title"`
+			Description          string     `json:"description"`
+			Thumbnails           Thumbnails `json:"thumbnails"`
+			ChannelTitle         string     `json:"channelTitle"`
+			Tags                 []string   `json:"tags"`
+			CategoryID           string     `json:"categoryId"`
+			LiveBroadcastContent string     `json:"liveBroadcastContent"`
 			Localized            struct {
 				Title       string `json:"title"`
 				Description string `json:"description"`
@@ -124,6 +72,7 @@ type ItemInformation struct {
 			LicensedContent   bool   `json:"licensedContent"`
 			RegionRestriction struct {
 				Allowed []string `json:"allowed"`
+				Blocked []string `json:"blocked"`
 			} `json:"regionRestriction"`
 			ContentRating struct {
 			} `json:"contentRating"`
@@ -134,4 +83,46 @@ type ItemInformation struct {
 		TotalResults   int `json:"totalResults"`
 		ResultsPerPage int `json:"resultsPerPage"`
 	} `json:"pageInfo"`
+	// filled from playlist item, not from API
+	PlaylistID    string `json:"-"`
+	Position      int    `json:"-"`
+	PlaylistTotal int    `json:"-"`
+}
+
+// PlaylistInformation - playlists information in YTv3 API
+type PlaylistInformation struct {
+	Kind  string `json:"kind"`
+	Etag  string `json:"etag"`
+	Items []struct {
+		Kind    string `json:"kind"`
+		Etag    string `json:"etag"`
+		ID      string `json:"id"`
+		Snippet struct {
+			PublishedAt  time.Time  `json:"publishedAt"`
+			ChannelID    string     `json:"channelId"`
+			Title        string     `json:"title"`
+			Description  string     `json:"description"`
+			ChannelTitle string     `json:"channelTitle"`
+			Thumbnails   Thumbnails `json:"thumbnails"`
+		} `json:"snippet"`
+	} `json:"items"`
+}
+
+// youtubeCategories - video categories of YTv3 API, used as genre
+var youtubeCategories = map[string]string{
+	"1":  "Film & Animation",
+	"2":  "Autos & Vehicles",
+	"10": "Music",
+	"15": "Pets & Animals",
+	"17": "Sports",
+	"19": "Travel & Events",
+	"20": "Gaming",
+	"22": "People & Blogs",
+	"23": "Comedy",
+	"24": "Entertainment",
+	"25": "News & Politics",
+	"26": "Howto & Style",
+	"27": "Education",
+	"28": "Science & Technology",
+	"29": "Nonprofits & Activism",
 }